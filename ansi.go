@@ -0,0 +1,61 @@
+package highlight
+
+import (
+	"context"
+	"io"
+	"iter"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/ansi"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// ColorDepth is the number of colors used in terminal output.
+type ColorDepth = ansi.ColorDepth
+
+const (
+	// ColorDepthAuto detects the color depth from the `NO_COLOR`, `COLORTERM`
+	// and `TERM` environment variables.
+	ColorDepthAuto = ansi.ColorDepthAuto
+	// ColorDepthNone prints no colors, only text attributes like bold.
+	ColorDepthNone = ansi.ColorDepthNone
+	// ColorDepth16 uses the 16 standard terminal colors.
+	ColorDepth16 = ansi.ColorDepth16
+	// ColorDepth256 uses the xterm 256-color palette.
+	ColorDepth256 = ansi.ColorDepth256
+	// ColorDepthTrueColor uses 24-bit colors.
+	ColorDepthTrueColor = ansi.ColorDepthTrueColor
+)
+
+// ANSIOptions configures the terminal output of [RenderANSI].
+type ANSIOptions struct {
+	// ColorDepth is the number of colors to use. Colors are converted to the
+	// nearest available color.
+	ColorDepth ColorDepth
+	// LineEndings is how carriage returns are written.
+	LineEndings LineEndings
+	// Whitespace configures tab expansion and marking whitespace. Marked
+	// whitespace is shown with faint glyphs.
+	Whitespace Whitespace
+}
+
+// RenderANSI renders a stream of highlight events, as returned by
+// [HighlightEvents], to w as text with ANSI escape sequences for terminals.
+// The style of each highlight is given by the style callback. Nested
+// highlights inherit the colors and attributes of the enclosing ones, and
+// styles are reset at the end of every line.
+func RenderANSI(w io.Writer, events iter.Seq2[Event, error], source string, styleCallback types.StyleCallback, options ANSIOptions) error {
+	return ansi.Render(w, events, source, styleCallback, options.ColorDepth, options.LineEndings, options.Whitespace)
+}
+
+// HighlightANSI highlights the given source code and writes it to w with
+// ANSI escape sequences for terminals. See [RenderANSI].
+func HighlightANSI(ctx context.Context, w io.Writer, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, styleCallback types.StyleCallback, options ANSIOptions) error {
+	return defaultHighlighter.HighlightANSI(ctx, w, cfg, source, injectionCallback, styleCallback, options)
+}
+
+// HighlightANSI highlights the given source code and writes it to w with
+// ANSI escape sequences for terminals. See [RenderANSI].
+func (h *Highlighter) HighlightANSI(ctx context.Context, w io.Writer, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, styleCallback types.StyleCallback, options ANSIOptions) error {
+	events := h.HighlightEvents(ctx, cfg, source, injectionCallback)
+	return RenderANSI(w, events, source, styleCallback, options)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"unsafe"
+
+	tree_sitter_go "github.com/tree-sitter/tree-sitter-go/bindings/go"
+	tree_sitter_html "github.com/tree-sitter/tree-sitter-html/bindings/go"
+	tree_sitter_json "github.com/tree-sitter/tree-sitter-json/bindings/go"
+	tree_sitter_python "github.com/tree-sitter/tree-sitter-python/bindings/go"
+)
+
+// builtinGrammar is a parser compiled into tsh through its Go bindings.
+type builtinGrammar struct {
+	language   func() unsafe.Pointer
+	extensions []string
+}
+
+// builtinGrammars are the parsers compiled into tsh, by language name. Their
+// queries are read from the config directory.
+var builtinGrammars = map[string]builtinGrammar{
+	"go":     {language: tree_sitter_go.Language, extensions: []string{"go"}},
+	"html":   {language: tree_sitter_html.Language, extensions: []string{"html", "htm"}},
+	"json":   {language: tree_sitter_json.Language, extensions: []string{"json"}},
+	"python": {language: tree_sitter_python.Language, extensions: []string{"py", "pyi"}},
+}
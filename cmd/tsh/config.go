@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/language"
+	"github.com/noclaps/go-tree-sitter-highlight/predicates"
+	"github.com/noclaps/go-tree-sitter-highlight/theme"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// standardNames are the capture names used by most grammars' highlight queries.
+var standardNames = []string{
+	"attribute",
+	"comment",
+	"constant",
+	"constant.builtin",
+	"constructor",
+	"embedded",
+	"function",
+	"function.builtin",
+	"keyword",
+	"module",
+	"number",
+	"operator",
+	"property",
+	"punctuation",
+	"punctuation.bracket",
+	"punctuation.delimiter",
+	"punctuation.special",
+	"string",
+	"string.special",
+	"tag",
+	"type",
+	"type.builtin",
+	"variable",
+	"variable.builtin",
+	"variable.parameter",
+}
+
+// defaultTheme is used when no theme is given.
+var defaultTheme = map[string]string{
+	"attribute":        "#d19a66",
+	"comment":          "#7f848e",
+	"constant":         "#d19a66",
+	"constructor":      "#e5c07b",
+	"function":         "#61afef",
+	"keyword":          "#c678dd",
+	"module":           "#e5c07b",
+	"number":           "#d19a66",
+	"operator":         "#56b6c2",
+	"property":         "#e06c75",
+	"punctuation":      "#abb2bf",
+	"string":           "#98c379",
+	"string.special":   "#56b6c2",
+	"tag":              "#e06c75",
+	"type":             "#e5c07b",
+	"variable.builtin": "#e06c75",
+}
+
+// defaultConfigDir returns the directory tsh reads its languages and themes from.
+func defaultConfigDir() string {
+	if dir := os.Getenv("TSH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tsh")
+}
+
+// loadRegistry registers the built-in languages, see [builtinGrammars], that
+// have queries in `queries/<name>` in the config directory, and all languages
+// in the config directory, see [language.LoadPluginDir].
+func loadRegistry(configDir string, recognisedNames []string) (*language.Registry, error) {
+	registry := language.NewRegistry(recognisedNames)
+	queriesDir := filepath.Join(configDir, "queries")
+
+	for _, name := range slices.Sorted(maps.Keys(builtinGrammars)) {
+		if _, err := os.Stat(filepath.Join(queriesDir, name, "highlights.scm")); err != nil {
+			continue
+		}
+
+		grammar := builtinGrammars[name]
+		lang, err := language.LoadQueryDir(queriesDir, name, grammar.language())
+		if err != nil {
+			return nil, err
+		}
+		registry.Register(language.Entry{
+			Language:   lang,
+			Extensions: grammar.extensions,
+		})
+	}
+
+	entries, err := language.LoadPluginDir(configDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		registry.Register(entry)
+	}
+	// Query files are often taken from nvim-treesitter, which uses predicates and directives of its own.
+	for name, predicate := range predicates.Predicates {
+		registry.RegisterPredicate(name, predicate)
+	}
+	for name, directive := range predicates.Directives {
+		registry.RegisterDirective(name, directive)
+	}
+	registry.SetInjectionDetector(registry.DetectLanguage)
+	return registry, nil
+}
+
+// loadTheme loads a theme by file path, or by name from the `themes` directory
+// in the config directory.
+func loadTheme(configDir string, name string) (*theme.Theme, error) {
+	if name == "" {
+		styles := make(map[string]types.Style, len(defaultTheme))
+		for captureName, color := range defaultTheme {
+			c, err := theme.ParseColor(color, nil)
+			if err != nil {
+				return nil, err
+			}
+			styles[captureName] = types.Style{Foreground: &c}
+		}
+		return theme.New("default", styles), nil
+	}
+
+	if _, err := os.Stat(name); err == nil {
+		return theme.LoadFile(name)
+	}
+
+	for _, ext := range []string{".toml", ".json", ".lua", ".vim"} {
+		path := filepath.Join(configDir, "themes", name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return theme.LoadFile(path)
+		}
+	}
+	return nil, fmt.Errorf("theme %s not found", name)
+}
+
+// recognisedNames returns the standard capture names, together with all
+// names the theme has styles for.
+func recognisedNames(t *theme.Theme) []string {
+	names := slices.Clone(standardNames)
+	for _, name := range t.Names() {
+		if !slices.Contains(names, name) && !strings.HasPrefix(name, "ui.") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
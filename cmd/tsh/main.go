@@ -0,0 +1,483 @@
+// Command tsh highlights source files with tree-sitter, and prints them as
+// HTML or as text with ANSI escape sequences for terminals.
+//
+// Usage:
+//
+//	tsh [flags] [file ...]
+//
+// Without files, the source is read from standard input. Languages are
+// detected from the file extension or the first line of the content. Parsers
+// for Go, HTML, JSON and Python are built in, and their queries, as well as
+// other languages, are loaded from the config directory (see -config).
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	highlight "github.com/noclaps/go-tree-sitter-highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/language"
+	"github.com/noclaps/go-tree-sitter-highlight/theme"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+const classPrefix = "tsh-"
+
+type options struct {
+	configDir   string
+	lang        string
+	format      string
+	theme       string
+	lineNumbers string
+	lines       string
+	highlight   string
+	color       string
+	lineEndings string
+	tabWidth    int
+	whitespace  string
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.configDir, "config", defaultConfigDir(), "`directory` to load grammars/, parsers/, queries/ and themes/ from")
+	flag.StringVar(&opts.lang, "lang", "", "`language` of the input, instead of detecting it")
+	flag.StringVar(&opts.format, "format", "", "output `format`: html, page (a standalone HTML page) or ansi (default ansi for terminals, html otherwise)")
+	flag.StringVar(&opts.theme, "theme", "", "`theme` name from the config directory, or path to a theme file")
+	flag.StringVar(&opts.lineNumbers, "line-numbers", "none", "line number `mode`: none, inline or table (html only)")
+	flag.StringVar(&opts.lines, "lines", "", "line `range` to print, e.g. 10:20, 10: or 10 (1-based, inclusive)")
+	flag.StringVar(&opts.highlight, "highlight-lines", "", "line `ranges` to highlight, e.g. {3-5,9} (html only)")
+	flag.StringVar(&opts.color, "color", "auto", "color `depth` for ansi output: auto, none, 16, 256 or truecolor")
+	flag.StringVar(&opts.lineEndings, "line-endings", "normalize", "`policy` for carriage returns: normalize, preserve or visible")
+	flag.IntVar(&opts.tabWidth, "tab-width", 0, "expand tabs to `columns` wide tab stops")
+	flag.StringVar(&opts.whitespace, "show-whitespace", "", "comma-separated `kinds` of whitespace to show: tabs, spaces and trailing")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tsh [flags] [file ...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(opts, flag.Args(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "tsh: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options, files []string, stdin io.Reader, stdout io.Writer) error {
+	if opts.format == "" {
+		opts.format = "html"
+		if f, ok := stdout.(*os.File); ok {
+			if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				opts.format = "ansi"
+			}
+		}
+	}
+	switch opts.format {
+	case "html", "page", "ansi":
+	default:
+		return fmt.Errorf("unknown format %s", opts.format)
+	}
+	switch opts.lineNumbers {
+	case "none", "inline":
+	case "table":
+		if opts.format == "ansi" {
+			return errors.New("table line numbers are only supported for html output")
+		}
+	default:
+		return fmt.Errorf("unknown line number mode %s", opts.lineNumbers)
+	}
+
+	firstLine, lastLine, err := parseLineRange(opts.lines)
+	if err != nil {
+		return err
+	}
+	highlightLines, err := highlight.ParseLineRanges(opts.highlight)
+	if err != nil {
+		return err
+	}
+	if len(highlightLines) > 0 && opts.format == "ansi" {
+		return errors.New("highlighted lines are only supported for html output")
+	}
+	colorDepth, err := parseColorDepth(opts.color)
+	if err != nil {
+		return err
+	}
+	lineEndings, err := parseLineEndings(opts.lineEndings)
+	if err != nil {
+		return err
+	}
+	whitespace, err := parseWhitespace(opts.whitespace)
+	if err != nil {
+		return err
+	}
+	whitespace.TabWidth = opts.tabWidth
+
+	lineNumbers := highlight.LineNumbersNone
+	switch opts.lineNumbers {
+	case "inline":
+		lineNumbers = highlight.LineNumbersCSS
+	case "table":
+		lineNumbers = highlight.LineNumbersTable
+	}
+
+	t, err := loadTheme(opts.configDir, opts.theme)
+	if err != nil {
+		return err
+	}
+	names := recognisedNames(t)
+	registry, err := loadRegistry(opts.configDir, names)
+	if err != nil {
+		return err
+	}
+
+	p := &printer{
+		format:      opts.format,
+		lang:        opts.lang,
+		lineNumbers: opts.lineNumbers,
+		lines:       highlight.LineRange{Start: firstLine, End: lastLine},
+		registry:    registry,
+		theme:       t,
+		names:       names,
+		ansiOptions: highlight.ANSIOptions{
+			ColorDepth:  colorDepth,
+			LineEndings: lineEndings,
+			Whitespace:  whitespace,
+		},
+		htmlOptions: highlight.HTMLOptions{
+			LineNumbers:    lineNumbers,
+			LineAnchors:    lineNumbers != highlight.LineNumbersNone,
+			StartLine:      firstLine,
+			HighlightLines: highlightLines,
+			ClassPrefix:    classPrefix,
+			LineEndings:    lineEndings,
+			Whitespace:     whitespace,
+		},
+	}
+
+	out := bufio.NewWriter(stdout)
+	if opts.format == "page" {
+		title := "tsh"
+		if len(files) == 1 {
+			title = filepath.Base(files[0])
+		}
+		writePageStart(out, title, t, names, p.htmlOptions)
+	}
+
+	// Every file is written as soon as it is highlighted, before the next one
+	// is read.
+	if len(files) == 0 {
+		files = []string{""}
+	}
+	for _, file := range files {
+		if err := p.print(out, file, stdin); err != nil {
+			out.Flush()
+			return err
+		}
+	}
+
+	if opts.format == "page" {
+		writePageEnd(out)
+	}
+	return out.Flush()
+}
+
+// printer highlights files and writes them in an output format.
+type printer struct {
+	format      string
+	lang        string
+	lineNumbers string
+	lines       highlight.LineRange
+	registry    *language.Registry
+	theme       *theme.Theme
+	names       []string
+	ansiOptions highlight.ANSIOptions
+	htmlOptions highlight.HTMLOptions
+}
+
+// print highlights a file, or standard input if the name is empty, and
+// writes it to w.
+func (p *printer) print(w io.Writer, file string, stdin io.Reader) error {
+	var (
+		content []byte
+		err     error
+	)
+	if file == "" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg, err := findConfig(p.registry, p.lang, file, content)
+	if err != nil {
+		return err
+	}
+
+	// Only the lines that are printed are highlighted.
+	source := string(content)
+	window := highlight.LineWindow(source, p.lines)
+	events := highlight.HighlightEventsWindow(context.Background(), *cfg, source, p.registry.InjectionCallback(), window)
+
+	switch p.format {
+	case "ansi":
+		lw := &lineWriter{w: w, number: p.lines.Start}
+		if p.lineNumbers == "inline" {
+			lines := countLines(source[window.StartByte:window.EndByte], p.ansiOptions.LineEndings)
+			lw.width = len(strconv.Itoa(p.lines.Start + max(lines, 1) - 1))
+		}
+		if err := highlight.RenderANSI(lw, events, source, p.theme.StyleCallback(p.names), p.ansiOptions); err != nil {
+			return err
+		}
+		return lw.endLine()
+	case "html":
+		return writeHTML(w, events, source, p.theme.InlineAttributeCallback(p.names), p.htmlOptions, false)
+	default:
+		return writeHTML(w, events, source, p.theme.ClassAttributeCallback(p.names, classPrefix), p.htmlOptions, true)
+	}
+}
+
+func findConfig(registry *language.Registry, lang string, name string, source []byte) (*types.Configuration, error) {
+	if lang != "" {
+		return registry.ForName(lang)
+	}
+
+	if name != "" {
+		cfg, err := registry.ForPath(name)
+		if !errors.Is(err, language.ErrUnknownLanguage) {
+			return cfg, err
+		}
+	}
+
+	cfg, err := registry.ForContent(source)
+	if errors.Is(err, language.ErrUnknownLanguage) && name == "" {
+		return nil, errors.New("can't detect the language of standard input, use -lang")
+	}
+	return cfg, err
+}
+
+// parseLineRange parses a 1-based, inclusive line range. A last line of
+// [math.MaxInt] means the end of the file.
+func parseLineRange(s string) (int, int, error) {
+	if s == "" {
+		return 1, math.MaxInt, nil
+	}
+
+	firstStr, lastStr, isRange := strings.Cut(s, ":")
+	first, err := strconv.Atoi(firstStr)
+	if err != nil || first < 1 {
+		return 0, 0, fmt.Errorf("invalid line range %s", s)
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	if lastStr == "" {
+		return first, math.MaxInt, nil
+	}
+	last, err := strconv.Atoi(lastStr)
+	if err != nil || last < first {
+		return 0, 0, fmt.Errorf("invalid line range %s", s)
+	}
+	return first, last, nil
+}
+
+func parseColorDepth(s string) (highlight.ColorDepth, error) {
+	switch s {
+	case "auto":
+		return highlight.ColorDepthAuto, nil
+	case "none":
+		return highlight.ColorDepthNone, nil
+	case "16":
+		return highlight.ColorDepth16, nil
+	case "256":
+		return highlight.ColorDepth256, nil
+	case "truecolor", "24bit":
+		return highlight.ColorDepthTrueColor, nil
+	default:
+		return 0, fmt.Errorf("unknown color depth %s", s)
+	}
+}
+
+func parseLineEndings(s string) (highlight.LineEndings, error) {
+	switch s {
+	case "normalize":
+		return highlight.LineEndingsNormalize, nil
+	case "preserve":
+		return highlight.LineEndingsPreserve, nil
+	case "visible":
+		return highlight.LineEndingsVisible, nil
+	default:
+		return 0, fmt.Errorf("unknown line endings %s", s)
+	}
+}
+
+func parseWhitespace(s string) (highlight.Whitespace, error) {
+	whitespace := highlight.Whitespace{Glyphs: true}
+	if s == "" {
+		return whitespace, nil
+	}
+
+	for kind := range strings.SplitSeq(s, ",") {
+		switch strings.TrimSpace(kind) {
+		case "tabs":
+			whitespace.Tabs = true
+		case "spaces":
+			whitespace.Spaces = true
+		case "trailing":
+			whitespace.Trailing = true
+		default:
+			return whitespace, fmt.Errorf("unknown kind of whitespace %s", kind)
+		}
+	}
+	return whitespace, nil
+}
+
+// countLines returns the number of lines the ANSI renderer writes for the
+// text with the line endings. A line break at the end doesn't start another
+// line.
+func countLines(text string, lineEndings highlight.LineEndings) int {
+	var lines int
+	inLine := false
+	for i := range len(text) {
+		lineBreak := text[i] == '\n' ||
+			text[i] == '\r' && lineEndings == highlight.LineEndingsNormalize && !strings.HasPrefix(text[i+1:], "\n")
+		if lineBreak {
+			lines++
+		}
+		inLine = !lineBreak
+	}
+	if inLine {
+		lines++
+	}
+	return lines
+}
+
+// lineWriter writes the output of the ANSI renderer, with a line number in
+// front of every line if width isn't 0. Styles are reset at every line break,
+// so the numbers don't get the style of the code. A lone `\r` is written as a
+// line break when line endings are normalized, and starts a new line in
+// highlight.LineWindow as well, so the line numbers stay in step with the
+// lines that are selected.
+type lineWriter struct {
+	w io.Writer
+	// number is the number of the next line.
+	number int
+	width  int
+	// inLine reports whether the current line was started.
+	inLine bool
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		if !lw.inLine {
+			if lw.width > 0 {
+				if _, err := fmt.Fprintf(lw.w, "\x1b[2m%*d\x1b[0m  ", lw.width, lw.number); err != nil {
+					return written, err
+				}
+			}
+			lw.inLine = true
+		}
+
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i != -1 {
+			line = p[:i+1]
+			lw.inLine = false
+			lw.number++
+		}
+		n, err := lw.w.Write(line)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(line):]
+	}
+	return written, nil
+}
+
+// endLine ends the last line with a line break, if it was started.
+func (lw *lineWriter) endLine() error {
+	if !lw.inLine {
+		return nil
+	}
+	lw.inLine = false
+	lw.number++
+	_, err := io.WriteString(lw.w, "\n")
+	return err
+}
+
+// writeHTML writes the highlighted code. Without a page for the stylesheet,
+// the styles of the line numbers and whitespace are written in front of the
+// code.
+func writeHTML(w io.Writer, events iter.Seq2[highlight.Event, error], source string, attributeCallback types.AttributeCallback, options highlight.HTMLOptions, page bool) error {
+	whitespace := options.Whitespace.Tabs || options.Whitespace.Spaces || options.Whitespace.Trailing
+	if !page && (options.LineNumbers != highlight.LineNumbersNone || len(options.HighlightLines) > 0 || whitespace) {
+		fmt.Fprintf(w, "<style>\n%s</style>\n", lineCSS(options))
+	}
+
+	if options.LineNumbers == highlight.LineNumbersTable {
+		fmt.Fprintf(w, "<div class=\"%scode\">", classPrefix)
+		if err := highlight.RenderHTMLWithOptions(w, events, source, attributeCallback, options); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "</div>\n")
+		return err
+	}
+
+	fmt.Fprintf(w, "<pre class=\"%scode\"><code>", classPrefix)
+	if err := highlight.RenderHTMLWithOptions(w, events, source, attributeCallback, options); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</code></pre>\n")
+	return err
+}
+
+// lineCSS returns the stylesheet for the line numbers and highlighted lines.
+func lineCSS(options highlight.HTMLOptions) string {
+	return options.CSS() + fmt.Sprintf(".%[1]sline-number, .%[1]sline::before { color: #7f848e; }\n", classPrefix)
+}
+
+// writePageStart writes the start of a standalone HTML page, with the
+// stylesheet for the theme. The highlighted files are written after it, and
+// [writePageEnd] ends the page.
+func writePageStart(w io.Writer, title string, t *theme.Theme, names []string, options highlight.HTMLOptions) {
+	var css strings.Builder
+	css.WriteString("body { margin: 0; }\n")
+	fmt.Fprintf(&css, ".%scode { margin: 0; padding: 1em; font-family: monospace; }\n", classPrefix)
+	css.WriteString(lineCSS(options))
+	if style, ok := t.Style("ui.background"); ok && style.Background != nil {
+		fmt.Fprintf(&css, "body { background-color: %s; }\n", theme.Hex(*style.Background))
+	}
+	if style, ok := t.Style("ui.text"); ok && style.Foreground != nil {
+		fmt.Fprintf(&css, "body { color: %s; }\n", theme.Hex(*style.Foreground))
+	}
+	css.WriteString(t.CSS(names, classPrefix))
+
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+%s</style>
+</head>
+<body>
+`, html.EscapeString(title), css.String())
+}
+
+// writePageEnd writes the end of the page started by [writePageStart].
+func writePageEnd(w io.Writer) {
+	io.WriteString(w, "</body>\n</html>\n")
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	highlight "github.com/noclaps/go-tree-sitter-highlight"
+)
+
+// writeFiles writes files with the given contents to a temporary directory,
+// and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// testConfigDir returns a config directory with queries for the built-in
+// Python parser.
+func testConfigDir(t *testing.T) string {
+	return writeFiles(t, map[string]string{
+		"queries/python/highlights.scm": "(identifier) @variable\n(integer) @number\n[\"def\" \"return\"] @keyword\n(comment) @comment\n",
+	})
+}
+
+func testOptions(configDir string) options {
+	return options{
+		configDir:   configDir,
+		format:      "ansi",
+		lineNumbers: "none",
+		color:       "none",
+		lineEndings: "normalize",
+	}
+}
+
+const testSource = "def f(x):\n    return x + 1\n# done\n"
+
+func TestRun(t *testing.T) {
+	configDir := testConfigDir(t)
+	dir := writeFiles(t, map[string]string{
+		"a.py":    testSource,
+		"b.py":    "y = 2\n",
+		"long.py": strings.Repeat("x = 1\n", 12),
+	})
+	a, b, long := filepath.Join(dir, "a.py"), filepath.Join(dir, "b.py"), filepath.Join(dir, "long.py")
+
+	tests := []struct {
+		name  string
+		edit  func(opts *options)
+		files []string
+		stdin string
+		// want is the output, or parts of it if contains is set.
+		want     string
+		contains []string
+	}{
+		{
+			name:  "ansi",
+			files: []string{a},
+			want:  testSource,
+		},
+		{
+			name:  "ansi colors",
+			edit:  func(opts *options) { opts.color = "16" },
+			files: []string{a},
+			want:  "\x1b[37mdef\x1b[0m f(x):\n    \x1b[37mreturn\x1b[0m x + \x1b[90m1\x1b[0m\n\x1b[90m# done\x1b[0m\n",
+		},
+		{
+			name:  "line numbers",
+			edit:  func(opts *options) { opts.lineNumbers = "inline" },
+			files: []string{a},
+			want:  "\x1b[2m1\x1b[0m  def f(x):\n\x1b[2m2\x1b[0m      return x + 1\n\x1b[2m3\x1b[0m  # done\n",
+		},
+		{
+			// The numbers are as wide as the last one.
+			name:  "line numbers of a window",
+			edit:  func(opts *options) { opts.lineNumbers = "inline"; opts.lines = "9:10" },
+			files: []string{long},
+			want:  "\x1b[2m 9\x1b[0m  x = 1\n\x1b[2m10\x1b[0m  x = 1\n",
+		},
+		{
+			name:  "window to the end",
+			edit:  func(opts *options) { opts.lines = "3:" },
+			files: []string{a},
+			want:  "# done\n",
+		},
+		{
+			name:  "without a line break at the end",
+			edit:  func(opts *options) { opts.lang = "python"; opts.lineNumbers = "inline" },
+			stdin: "x = 1",
+			want:  "\x1b[2m1\x1b[0m  x = 1\n",
+		},
+		{
+			name:  "several files",
+			files: []string{a, b},
+			want:  testSource + "y = 2\n",
+		},
+		{
+			name:  "standard input",
+			edit:  func(opts *options) { opts.lang = "python" },
+			stdin: "y = 2\n",
+			want:  "y = 2\n",
+		},
+		{
+			name:  "html",
+			edit:  func(opts *options) { opts.format = "html" },
+			files: []string{b},
+			want:  "<pre class=\"tsh-code\"><code><span>y</span> = <span style=\"color: #d19a66;\">2</span>\n</code></pre>\n",
+		},
+		{
+			name:  "html with line numbers",
+			edit:  func(opts *options) { opts.format = "html"; opts.lineNumbers = "table"; opts.highlight = "2" },
+			files: []string{a},
+			contains: []string{
+				"<style>\ntable.tsh-lines {",
+				`<div class="tsh-code"><table class="tsh-lines"><tbody>`,
+				`<tr id="L2" class="tsh-line tsh-highlighted" data-line="2"><td class="tsh-line-number">2</td>`,
+			},
+		},
+		{
+			name:  "page",
+			edit:  func(opts *options) { opts.format = "page" },
+			files: []string{b},
+			contains: []string{
+				"<!DOCTYPE html>\n",
+				"<title>b.py</title>",
+				".tsh-number { color: #d19a66; }",
+				"<body>\n<pre class=\"tsh-code\"><code><span class=\"tsh-variable\">y</span> = <span class=\"tsh-number\">2</span>\n</code></pre>\n</body>\n</html>\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions(configDir)
+			if tt.edit != nil {
+				tt.edit(&opts)
+			}
+
+			var out bytes.Buffer
+			if err := run(opts, tt.files, strings.NewReader(tt.stdin), &out); err != nil {
+				t.Fatal(err)
+			}
+			if tt.contains == nil && out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	configDir := testConfigDir(t)
+	dir := writeFiles(t, map[string]string{"a.py": testSource, "a.unknown": "x"})
+
+	tests := []struct {
+		name  string
+		edit  func(opts *options)
+		files []string
+		stdin string
+		want  string
+	}{
+		{name: "unknown format", edit: func(opts *options) { opts.format = "pdf" }, want: "unknown format pdf"},
+		{name: "table line numbers in ansi", edit: func(opts *options) { opts.lineNumbers = "table" }, want: "table line numbers are only supported for html output"},
+		{name: "highlighted lines in ansi", edit: func(opts *options) { opts.highlight = "1" }, want: "highlighted lines are only supported for html output"},
+		{name: "line range", edit: func(opts *options) { opts.lines = "3:2" }, want: "invalid line range 3:2"},
+		{name: "unknown language of standard input", stdin: "x", want: "can't detect the language of standard input, use -lang"},
+		{name: "unknown language", files: []string{filepath.Join(dir, "a.unknown")}, want: "unknown language"},
+		{name: "missing file", files: []string{filepath.Join(dir, "missing.py")}, want: "no such file or directory"},
+		{name: "missing theme", edit: func(opts *options) { opts.theme = "missing" }, want: "theme missing not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions(configDir)
+			if tt.edit != nil {
+				tt.edit(&opts)
+			}
+
+			err := run(opts, tt.files, strings.NewReader(tt.stdin), &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunWritesFilesBeforeErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.py": testSource})
+
+	// The first file is written before the second one fails to be read.
+	var out bytes.Buffer
+	err := run(testOptions(testConfigDir(t)), []string{filepath.Join(dir, "a.py"), filepath.Join(dir, "missing.py")}, strings.NewReader(""), &out)
+	if err == nil {
+		t.Fatal("got no error")
+	}
+	if out.String() != testSource {
+		t.Errorf("got %q, want %q", out.String(), testSource)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		width  int
+		want   string
+	}{
+		{name: "no numbers", writes: []string{"a\nb", "c\n"}, want: "a\nbc\n"},
+		{name: "numbers", writes: []string{"a\nb", "c\n", "d"}, width: 2, want: "\x1b[2m 8\x1b[0m  a\n\x1b[2m 9\x1b[0m  bc\n\x1b[2m10\x1b[0m  d\n"},
+		{name: "empty lines", writes: []string{"\n\n"}, width: 1, want: "\x1b[2m8\x1b[0m  \n\x1b[2m9\x1b[0m  \n"},
+		{name: "nothing", writes: nil, width: 1, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			lw := &lineWriter{w: &out, number: 8, width: tt.width}
+			for _, s := range tt.writes {
+				if n, err := lw.Write([]byte(s)); n != len(s) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if err := lw.endLine(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		text        string
+		lineEndings highlight.LineEndings
+		want        int
+	}{
+		{text: "", want: 0},
+		{text: "a", want: 1},
+		{text: "a\n", want: 1},
+		{text: "a\nb", want: 2},
+		{text: "\n\n", want: 2},
+		{text: "a\r\nb\r\n", want: 2},
+		{text: "a\rb\r", want: 2},
+		{text: "a\rb\r", lineEndings: highlight.LineEndingsPreserve, want: 1},
+	}
+	for _, tt := range tests {
+		if got := countLines(tt.text, tt.lineEndings); got != tt.want {
+			t.Errorf("countLines(%q, %d) = %d, want %d", tt.text, tt.lineEndings, got, tt.want)
+		}
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		s         string
+		wantFirst int
+		wantLast  int
+		wantErr   bool
+	}{
+		{s: "", wantFirst: 1, wantLast: math.MaxInt},
+		{s: "10", wantFirst: 10, wantLast: 10},
+		{s: "10:20", wantFirst: 10, wantLast: 20},
+		{s: "10:", wantFirst: 10, wantLast: math.MaxInt},
+		{s: "0", wantErr: true},
+		{s: "20:10", wantErr: true},
+		{s: ":10", wantErr: true},
+		{s: "a:b", wantErr: true},
+	}
+	for _, tt := range tests {
+		first, last, err := parseLineRange(tt.s)
+		if (err != nil) != tt.wantErr || first != tt.wantFirst || last != tt.wantLast {
+			t.Errorf("parseLineRange(%q) = %d, %d, %v, want %d, %d, error %t", tt.s, first, last, err, tt.wantFirst, tt.wantLast, tt.wantErr)
+		}
+	}
+}
+
+func TestParseWhitespace(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    highlight.Whitespace
+		wantErr bool
+	}{
+		{s: "", want: highlight.Whitespace{Glyphs: true}},
+		{s: "tabs", want: highlight.Whitespace{Glyphs: true, Tabs: true}},
+		{s: "tabs, spaces,trailing", want: highlight.Whitespace{Glyphs: true, Tabs: true, Spaces: true, Trailing: true}},
+		{s: "newlines", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseWhitespace(tt.s)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("parseWhitespace(%q) = %+v, %v, want %+v, error %t", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseColorDepthAndLineEndings(t *testing.T) {
+	for s, want := range map[string]highlight.ColorDepth{"auto": highlight.ColorDepthAuto, "none": highlight.ColorDepthNone, "16": highlight.ColorDepth16, "256": highlight.ColorDepth256, "truecolor": highlight.ColorDepthTrueColor, "24bit": highlight.ColorDepthTrueColor} {
+		if got, err := parseColorDepth(s); got != want || err != nil {
+			t.Errorf("parseColorDepth(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	if _, err := parseColorDepth("8"); err == nil {
+		t.Error("parseColorDepth(\"8\") returned no error")
+	}
+
+	for s, want := range map[string]highlight.LineEndings{"normalize": highlight.LineEndingsNormalize, "preserve": highlight.LineEndingsPreserve, "visible": highlight.LineEndingsVisible} {
+		if got, err := parseLineEndings(s); got != want || err != nil {
+			t.Errorf("parseLineEndings(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	if _, err := parseLineEndings("crlf"); err == nil {
+		t.Error("parseLineEndings(\"crlf\") returned no error")
+	}
+}
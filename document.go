@@ -0,0 +1,338 @@
+package highlight
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
+	ts_iter "github.com/noclaps/go-tree-sitter-highlight/internal/iter"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// Document is a source document that keeps the syntax trees of its root
+// language and of every injection between edits, so that it can be reparsed
+// incrementally. A Document is not safe for concurrent use.
+type Document struct {
+	highlighter       *Highlighter
+	cfg               types.Configuration
+	injectionCallback types.InjectionCallback
+	source            string
+	layers            []ts_iter.Layer
+}
+
+// NewDocument parses the source and all of its injections using a shared
+// [Highlighter]. See [Highlighter.NewDocument].
+func NewDocument(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback) (*Document, error) {
+	return defaultHighlighter.NewDocument(ctx, cfg, source, injectionCallback)
+}
+
+// NewDocument parses the source and all of its injections, and returns a
+// [Document] that can be edited and highlighted. The document must be closed
+// when it is no longer needed.
+func (h *Highlighter) NewDocument(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback) (*Document, error) {
+	d := &Document{
+		highlighter:       h,
+		cfg:               cfg,
+		injectionCallback: injectionCallback,
+		source:            source,
+	}
+
+	layers, err := d.parse(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	d.layers = layers
+	return d, nil
+}
+
+// Source returns the current source of the document.
+func (d *Document) Source() string {
+	return d.source
+}
+
+// Edit updates the document to the new source, which is the old source with
+// the given edits applied, in order. The root language and every injection
+// are reparsed incrementally. Edit returns the byte ranges of the new source
+// whose highlighting may have changed, sorted and without overlaps. Only these
+// ranges need to be rendered again.
+//
+// The ranges include the edited text, the nodes it is in, and whatever the
+// syntax trees changed in. If an edit touches a local definition, like a
+// parameter, the whole local scope of the definition is included, since the
+// highlighting of its references may have changed.
+//
+// If reparsing fails, e.g. because the context is cancelled, the document is
+// left unchanged.
+func (d *Document) Edit(ctx context.Context, source string, edits ...tree_sitter.InputEdit) ([]tree_sitter.Range, error) {
+	// Edit copies of the trees, so the document stays intact if parsing fails.
+	oldTrees := make([]*tree_sitter.Tree, len(d.layers))
+	for i, layer := range d.layers {
+		oldTrees[i] = layer.Tree.Clone()
+		for _, edit := range edits {
+			oldTrees[i].Edit(&edit)
+		}
+	}
+	defer func() {
+		for _, tree := range oldTrees {
+			tree.Close()
+		}
+	}()
+
+	used := make([]bool, len(d.layers))
+	oldSource := d.source
+	d.source = source
+	layers, err := d.parse(ctx, func(languageName string, depth uint, ranges []tree_sitter.Range) *tree_sitter.Tree {
+		for i, layer := range d.layers {
+			if used[i] || layer.Depth != depth || layer.Config.LanguageName != languageName {
+				continue
+			}
+			if depth == 0 || oldTrees[i].IncludedRanges()[0].StartByte == ranges[0].StartByte {
+				used[i] = true
+				return oldTrees[i]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		d.source = oldSource
+		return nil, err
+	}
+
+	edited := editedRanges(edits, source)
+	changed := slices.Clone(edited)
+	for _, layer := range layers {
+		if layer.OldTree == nil {
+			// This layer is new, so all of it has changed.
+			changed = append(changed, layer.Ranges...)
+			continue
+		}
+		changed = append(changed, layer.OldTree.ChangedRanges(layer.Tree)...)
+		changed = append(changed, editedNodes(layer.Tree, edited)...)
+		// Definitions that were removed are only in the old tree, which has been edited to match
+		// the new source.
+		changed = append(changed, definitionScopes(layer, layer.OldTree, edited, []byte(source))...)
+		changed = append(changed, definitionScopes(layer, layer.Tree, edited, []byte(source))...)
+	}
+	for i, layer := range d.layers {
+		if !used[i] {
+			// This layer no longer exists, so whatever it covered has changed.
+			changed = append(changed, oldTrees[i].IncludedRanges()...)
+		}
+		layer.Tree.Close()
+	}
+	// The old trees are closed when Edit returns.
+	for i := range layers {
+		layers[i].OldTree = nil
+	}
+	d.layers = layers
+
+	return mergeRanges(changed, source), nil
+}
+
+// Highlight highlights the document and returns the highlighted HTML. See [Highlight].
+func (d *Document) Highlight(ctx context.Context, attributeCallback types.AttributeCallback) (string, error) {
+	return html.Render(d.HighlightEvents(ctx), d.source, attributeCallback)
+}
+
+// HighlightTo highlights the document and streams the highlighted HTML to w. See [HighlightTo].
+func (d *Document) HighlightTo(ctx context.Context, w io.Writer, attributeCallback types.AttributeCallback) error {
+	return html.RenderTo(w, d.HighlightEvents(ctx), d.source, attributeCallback)
+}
+
+// HighlightEvents returns the highlight events for the document, using the
+// trees that are already parsed. See [HighlightEvents].
+func (d *Document) HighlightEvents(ctx context.Context) iter.Seq2[Event, error] {
+	return d.highlighter.highlightEvents(ctx, d.cfg, d.source, d.injectionCallback, documentTrees(d.layers), nil)
+}
+
+// Close frees the syntax trees of the document.
+func (d *Document) Close() {
+	for _, layer := range d.layers {
+		layer.Tree.Close()
+	}
+	d.layers = nil
+}
+
+// documentTrees provides the parsed trees of a [Document] to the iterator.
+type documentTrees []ts_iter.Layer
+
+func (t documentTrees) Tree(languageName string, ranges []tree_sitter.Range) *tree_sitter.Tree {
+	for _, layer := range t {
+		if layer.Config.LanguageName == languageName && ts_iter.EqualRanges(layer.Ranges, ranges) {
+			return layer.Tree
+		}
+	}
+	return nil
+}
+
+func (d *Document) parse(ctx context.Context, oldTree ts_iter.OldTreeFunc) ([]ts_iter.Layer, error) {
+	highlighter := d.highlighter.acquire(d.cfg.Language)
+	defer d.highlighter.release(d.cfg.Language, highlighter)
+
+	return ts_iter.ParseLayers(ctx, []byte(d.source), "", highlighter, d.injectionCallback, d.cfg, []tree_sitter.Range{
+		{
+			StartByte:  0,
+			EndByte:    ^uint(0),
+			StartPoint: tree_sitter.NewPoint(0, 0),
+			EndPoint:   tree_sitter.NewPoint(^uint(0), ^uint(0)),
+		},
+	}, oldTree)
+}
+
+// editedRanges returns the ranges of the new source that the edits, applied
+// in order, replaced. The ranges of earlier edits are moved by later ones.
+func editedRanges(edits []tree_sitter.InputEdit, source string) []tree_sitter.Range {
+	var bounds [][2]uint
+	for _, edit := range edits {
+		for i := range bounds {
+			bounds[i][0] = editedOffset(bounds[i][0], edit, edit.StartByte)
+			bounds[i][1] = editedOffset(bounds[i][1], edit, edit.NewEndByte)
+		}
+		bounds = append(bounds, [2]uint{edit.StartByte, edit.NewEndByte})
+	}
+
+	ranges := make([]tree_sitter.Range, 0, len(bounds))
+	for _, b := range bounds {
+		start, end := min(b[0], uint(len(source))), min(b[1], uint(len(source)))
+		ranges = append(ranges, tree_sitter.Range{
+			StartByte:  start,
+			StartPoint: pointAt(source, start),
+			EndByte:    end,
+			EndPoint:   pointAt(source, end),
+		})
+	}
+	return ranges
+}
+
+// editedOffset moves an offset by an edit. Offsets in the replaced text are
+// moved to inside, the start or the end of the new text.
+func editedOffset(offset uint, edit tree_sitter.InputEdit, inside uint) uint {
+	switch {
+	case offset <= edit.StartByte:
+		return offset
+	case offset >= edit.OldEndByte:
+		return offset - edit.OldEndByte + edit.NewEndByte
+	default:
+		return inside
+	}
+}
+
+// editedNodes returns the ranges of the leaf nodes at the start and end of
+// the edited ranges. Their text changed, even if the tree didn't, like when
+// an identifier is renamed.
+func editedNodes(tree *tree_sitter.Tree, edited []tree_sitter.Range) []tree_sitter.Range {
+	var ranges []tree_sitter.Range
+	root := tree.RootNode()
+	for _, r := range edited {
+		for _, offset := range []uint{r.StartByte, r.EndByte} {
+			if node := root.DescendantForByteRange(offset, offset); node != nil && node.ChildCount() == 0 {
+				ranges = append(ranges, node.Range())
+			}
+		}
+	}
+	return ranges
+}
+
+// definitionScopes returns the ranges of the innermost local scopes of the
+// local definitions in the tree that overlap the edited ranges, or the ranges
+// of the layer for definitions outside of any scope. The references to a
+// definition can be anywhere in its scope.
+func definitionScopes(layer ts_iter.Layer, tree *tree_sitter.Tree, edited []tree_sitter.Range, source []byte) []tree_sitter.Range {
+	cfg := layer.Config
+	if cfg.LocalDefCaptureIndex == nil {
+		return nil
+	}
+
+	cursor := tree_sitter.NewQueryCursor()
+	defer cursor.Close()
+
+	var ranges []tree_sitter.Range
+	for _, r := range edited {
+		cursor.SetByteRange(r.StartByte, max(r.EndByte, r.StartByte+1))
+
+		var definitions []tree_sitter.Node
+		var scopes []tree_sitter.Node
+		captures := cursor.Captures(cfg.Query, tree.RootNode(), source)
+		for {
+			match, index := captures.Next()
+			if match == nil {
+				break
+			}
+			if match.PatternIndex < cfg.LocalsPatternIndex || match.PatternIndex >= cfg.HighlightsPatternIndex {
+				continue
+			}
+
+			capture := match.Captures[index]
+			switch {
+			case uint(capture.Index) == *cfg.LocalDefCaptureIndex:
+				if capture.Node.StartByte() <= r.EndByte && r.StartByte <= capture.Node.EndByte() {
+					definitions = append(definitions, capture.Node)
+				}
+			case cfg.LocalScopeCaptureIndex != nil && uint(capture.Index) == *cfg.LocalScopeCaptureIndex:
+				scopes = append(scopes, capture.Node)
+			}
+		}
+
+		for _, definition := range definitions {
+			var scope *tree_sitter.Node
+			for _, s := range scopes {
+				if s.StartByte() <= definition.StartByte() && definition.EndByte() <= s.EndByte() &&
+					(scope == nil || s.EndByte()-s.StartByte() < scope.EndByte()-scope.StartByte()) {
+					scope = &s
+				}
+			}
+			if scope == nil {
+				ranges = append(ranges, layer.Ranges...)
+			} else {
+				ranges = append(ranges, scope.Range())
+			}
+		}
+	}
+	return ranges
+}
+
+// mergeRanges sorts the ranges, clamps them to the source and merges the ones
+// that overlap or touch.
+func mergeRanges(ranges []tree_sitter.Range, source string) []tree_sitter.Range {
+	slices.SortFunc(ranges, func(a tree_sitter.Range, b tree_sitter.Range) int {
+		return cmp.Compare(a.StartByte, b.StartByte)
+	})
+
+	var result []tree_sitter.Range
+	for _, r := range ranges {
+		if r.EndByte > uint(len(source)) {
+			r.EndByte = uint(len(source))
+			r.EndPoint = pointAt(source, r.EndByte)
+		}
+		if r.StartByte >= r.EndByte {
+			continue
+		}
+
+		if len(result) > 0 && r.StartByte <= result[len(result)-1].EndByte {
+			last := &result[len(result)-1]
+			if r.EndByte > last.EndByte {
+				last.EndByte = r.EndByte
+				last.EndPoint = r.EndPoint
+			}
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// pointAt returns the row and byte column of the given byte offset in source.
+func pointAt(source string, offset uint) tree_sitter.Point {
+	source = source[:offset]
+	row := uint(strings.Count(source, "\n"))
+	column := offset
+	if i := strings.LastIndexByte(source, '\n'); i != -1 {
+		column = offset - uint(i) - 1
+	}
+	return tree_sitter.NewPoint(row, column)
+}
@@ -0,0 +1,209 @@
+package highlight
+
+import (
+	"context"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// highlightNames returns the name of the innermost highlight of every byte of
+// the source, or "" for bytes without one. The names are from [testlang.Names].
+func highlightNames(t *testing.T, events iter.Seq2[Event, error], length int) []string {
+	t.Helper()
+
+	names := make([]string, length)
+	var stack []string
+	for event, err := range events {
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e := event.(type) {
+		case EventCaptureStart:
+			stack = append(stack, testlang.Names[e.Highlight])
+		case EventCaptureEnd:
+			stack = stack[:len(stack)-1]
+		case EventSource:
+			if len(stack) > 0 {
+				for i := e.StartByte; i < e.EndByte; i++ {
+					names[i] = stack[len(stack)-1]
+				}
+			}
+		}
+	}
+	return names
+}
+
+func TestDocumentEdit(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		// old is replaced with new in the source. They have the same length,
+		// so that the highlights before and after can be compared byte by byte.
+		old string
+		new string
+		// changed and unchanged are parts of the new source that must and
+		// must not be in the changed ranges.
+		changed   []string
+		unchanged []string
+	}{
+		{
+			name:      "rename parameter",
+			source:    "def f(x):\n    return x + 1\n\ny = x\n",
+			old:       "(x)",
+			new:       "(q)",
+			changed:   []string{"(q)", "return x + 1"},
+			unchanged: []string{"y = x"},
+		},
+		{
+			name:      "rename reference",
+			source:    "def f(x):\n    return x + 1\n\ny = x\n",
+			old:       "return x",
+			new:       "return q",
+			changed:   []string{"q"},
+			unchanged: []string{"def f(x)", "y = x"},
+		},
+		{
+			name:      "rename global",
+			source:    "x = 1\ndef f():\n    return x\n",
+			old:       "x = 1",
+			new:       "q = 1",
+			changed:   []string{"q = 1", "return x"},
+			unchanged: nil,
+		},
+		{
+			name:      "string contents",
+			source:    "a = 1\ns = \"abc\"\nb = 2\n",
+			old:       "abc",
+			new:       "abd",
+			changed:   []string{"abd"},
+			unchanged: []string{"a = 1", "b = 2"},
+		},
+		{
+			name:      "injected string contents",
+			source:    "a = 1\nexec(\"b = 2\")\nc = 3\n",
+			old:       "b = 2",
+			new:       "b = 4",
+			changed:   []string{"4"},
+			unchanged: []string{"a = 1", "c = 3"},
+		},
+	}
+
+	cfg := testlang.Config(t, "python")
+	injectionCallback := testlang.InjectionCallback(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			doc, err := NewDocument(ctx, *cfg, tt.source, injectionCallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer doc.Close()
+			before := highlightNames(t, doc.HighlightEvents(ctx), len(tt.source))
+
+			start := strings.Index(tt.source, tt.old)
+			source := tt.source[:start] + tt.new + tt.source[start+len(tt.old):]
+			changed, err := doc.Edit(ctx, source, tree_sitter.InputEdit{
+				StartByte:      uint(start),
+				OldEndByte:     uint(start + len(tt.old)),
+				NewEndByte:     uint(start + len(tt.new)),
+				StartPosition:  pointAt(tt.source, uint(start)),
+				OldEndPosition: pointAt(tt.source, uint(start+len(tt.old))),
+				NewEndPosition: pointAt(source, uint(start+len(tt.new))),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := highlightNames(t, doc.HighlightEvents(ctx), len(source))
+
+			inChanged := func(offset int) bool {
+				for _, r := range changed {
+					if r.StartByte <= uint(offset) && uint(offset) < r.EndByte {
+						return true
+					}
+				}
+				return false
+			}
+			for i := range source {
+				if (before[i] != after[i] || tt.source[i] != source[i]) && !inChanged(i) {
+					t.Errorf("byte %d (%q) changed from %q to %q, but isn't in the changed ranges %v", i, source[i], before[i], after[i], changed)
+				}
+			}
+			for _, part := range tt.changed {
+				offset := strings.Index(source, part)
+				for i := offset; i < offset+len(part); i++ {
+					if !inChanged(i) {
+						t.Errorf("%q isn't in the changed ranges %v", part, changed)
+						break
+					}
+				}
+			}
+			for _, part := range tt.unchanged {
+				offset := strings.LastIndex(source, part)
+				for i := offset; i < offset+len(part); i++ {
+					if inChanged(i) {
+						t.Errorf("%q is in the changed ranges %v", part, changed)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDocumentEditTwice(t *testing.T) {
+	ctx := context.Background()
+	cfg := testlang.Config(t, "python")
+	injectionCallback := testlang.InjectionCallback(t)
+
+	source := "a = 1\nexec(\"b = 2\")\nc = 3\n"
+	doc, err := NewDocument(ctx, *cfg, source, injectionCallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer doc.Close()
+
+	// Each edit parses incrementally from the trees of the edit before, and
+	// compares them to the new ones.
+	for _, edit := range []struct{ old, new string }{
+		{"b = 2", "b = 4"},
+		{"c = 3", "c = x"},
+		{"b = 4", "b = y"},
+	} {
+		start := strings.Index(source, edit.old)
+		newSource := source[:start] + edit.new + source[start+len(edit.old):]
+		_, err := doc.Edit(ctx, newSource, tree_sitter.InputEdit{
+			StartByte:      uint(start),
+			OldEndByte:     uint(start + len(edit.old)),
+			NewEndByte:     uint(start + len(edit.new)),
+			StartPosition:  pointAt(source, uint(start)),
+			OldEndPosition: pointAt(source, uint(start+len(edit.old))),
+			NewEndPosition: pointAt(newSource, uint(start+len(edit.new))),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		source = newSource
+
+		for _, layer := range doc.layers {
+			if layer.OldTree != nil {
+				t.Errorf("layer %s keeps its closed old tree", layer.Config.LanguageName)
+			}
+		}
+	}
+
+	fresh, err := NewDocument(ctx, *cfg, source, injectionCallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	got := highlightNames(t, doc.HighlightEvents(ctx), len(source))
+	want := highlightNames(t, fresh.HighlightEvents(ctx), len(source))
+	if !slices.Equal(got, want) {
+		t.Errorf("got highlights %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package highlight
+
+import "github.com/noclaps/go-tree-sitter-highlight/internal/events"
+
+// Event is a highlight event produced by [HighlightEvents].
+// Possible implementations are:
+// - [EventLayerStart]
+// - [EventLayerEnd]
+// - [EventCaptureStart]
+// - [EventCaptureEnd]
+// - [EventSource]
+type Event = events.Event
+
+// EventSource is emitted when a source code range is highlighted. The range is
+// given as byte offsets into the source passed to [HighlightEvents].
+type EventSource = events.EventSource
+
+// EventLayerStart is emitted when a language layer starts, either the root
+// language or an injected one.
+type EventLayerStart = events.EventLayerStart
+
+// EventLayerEnd is emitted when a language layer ends. Layers don't nest:
+// [HighlightEvents] emits an EventLayerEnd before every [EventLayerStart] but
+// the first, when it switches to another layer, and highlights that are open
+// stay open across the switch. There is no EventLayerEnd for the last layer.
+type EventLayerEnd = events.EventLayerEnd
+
+// EventCaptureStart is emitted when a highlight region starts.
+type EventCaptureStart = events.EventCaptureStart
+
+// EventCaptureEnd is emitted when a highlight region ends.
+type EventCaptureEnd = events.EventCaptureEnd
@@ -2,6 +2,12 @@ module github.com/noclaps/go-tree-sitter-highlight
 
 go 1.24.4
 
-require github.com/tree-sitter/go-tree-sitter v0.25.0
+require (
+	github.com/tree-sitter/go-tree-sitter v0.25.0
+	github.com/tree-sitter/tree-sitter-embedded-template v0.23.2
+	github.com/tree-sitter/tree-sitter-html v0.23.2
+	github.com/tree-sitter/tree-sitter-json v0.24.8
+	github.com/tree-sitter/tree-sitter-python v0.25.0
+)
 
 require github.com/mattn/go-pointer v0.0.1 // indirect
@@ -2,70 +2,39 @@ package highlight
 
 import (
 	"context"
+	"io"
 	"iter"
 
-	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
-	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
-	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
-	ts_iter "github.com/noclaps/go-tree-sitter-highlight/internal/iter"
 	"github.com/noclaps/go-tree-sitter-highlight/types"
-	tree_sitter "github.com/tree-sitter/go-tree-sitter"
 )
 
 // Highlight highlights the given source code using the given configuration.
 // The source code is expected to be UTF-8 encoded. The function returns the
 // highlighted HTML or an error.
+//
+// It uses a shared [Highlighter], so parsers and cursors are reused between calls.
 func Highlight(cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) (string, error) {
-	h := &highlight.Highlighter{
-		Parser: tree_sitter.NewParser(),
-	}
-	layers, err := ts_iter.NewIterLayers([]byte(source), "", h, types.InjectionCallback(injectionCallback), types.Configuration(cfg), 0, []tree_sitter.Range{
-		{
-			StartByte:  0,
-			EndByte:    ^uint(0),
-			StartPoint: tree_sitter.NewPoint(0, 0),
-			EndPoint:   tree_sitter.NewPoint(^uint(0), ^uint(0)),
-		},
-	})
-	if err != nil {
-		return "", err
-	}
-
-	i := &ts_iter.Iterator{
-		Ctx:                context.Background(),
-		Source:             []byte(source),
-		LanguageName:       cfg.LanguageName,
-		ByteOffset:         0,
-		Highlighter:        h,
-		InjectionCallback:  types.InjectionCallback(injectionCallback),
-		Layers:             layers,
-		NextEvents:         nil,
-		LastHighlightRange: nil,
-	}
-	i.SortLayers()
-
-	var events iter.Seq2[events.Event, error] = func(yield func(events.Event, error) bool) {
-		for {
-			event, err := i.Next()
-			if err != nil {
-				yield(nil, err)
-
-				// error we are done
-				return
-			}
+	return defaultHighlighter.Highlight(cfg, source, injectionCallback, attributeCallback)
+}
 
-			if event == nil {
-				// we're done if there are no more events
-				return
-			}
+// HighlightContext is like [Highlight], but stops parsing and highlighting as
+// soon as the context is cancelled or its deadline is exceeded. In that case
+// the returned error wraps the context's error.
+func HighlightContext(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) (string, error) {
+	return defaultHighlighter.HighlightContext(ctx, cfg, source, injectionCallback, attributeCallback)
+}
 
-			// yield the event
-			if !yield(event, nil) {
-				// if the consumer returns false we can stop
-				return
-			}
-		}
-	}
+// HighlightTo is like [HighlightContext], but streams the highlighted HTML to
+// w, e.g. an [net/http.ResponseWriter] or a file, instead of building a
+// string. Writes are buffered.
+func HighlightTo(ctx context.Context, w io.Writer, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) error {
+	return defaultHighlighter.HighlightTo(ctx, w, cfg, source, injectionCallback, attributeCallback)
+}
 
-	return html.Render(events, source, types.AttributeCallback(attributeCallback))
+// HighlightEvents highlights the given source code using the given
+// configuration and returns the raw stream of highlight events. This can be
+// used to write custom renderers. The stream stops after the first error, or
+// when the context is cancelled.
+func HighlightEvents(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback) iter.Seq2[Event, error] {
+	return defaultHighlighter.HighlightEvents(ctx, cfg, source, injectionCallback)
 }
@@ -0,0 +1,151 @@
+package highlight
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+var printPattern = regexp.MustCompile(`\bprint\b`)
+
+func TestHighlightEventsLocals(t *testing.T) {
+	// Every case uses the identifier print, which is a builtin function unless
+	// it refers to a local definition.
+	tests := []struct {
+		name   string
+		source string
+		// want are the highlights of the occurrences of print, in order.
+		want []string
+	}{
+		{
+			name:   "not local",
+			source: "print(1)\n",
+			want:   []string{"function.builtin"},
+		},
+		{
+			name:   "parameter",
+			source: "def f(print):\n    return print\n",
+			want:   []string{"variable.parameter", "variable.parameter"},
+		},
+		{
+			name:   "parameter out of scope",
+			source: "def f(print):\n    return print\nprint(1)\n",
+			want:   []string{"variable.parameter", "variable.parameter", "function.builtin"},
+		},
+		{
+			name:   "shadowed parameter",
+			source: "print = 1\ndef f(print):\n    return print\nprint\n",
+			want:   []string{"variable", "variable.parameter", "variable.parameter", "variable"},
+		},
+		{
+			name:   "shadowed by nested parameter",
+			source: "def f(print):\n    g = lambda print: print\n    return print\n",
+			want:   []string{"variable.parameter", "variable", "variable", "variable.parameter"},
+		},
+		{
+			name:   "inheriting scope",
+			source: "def f(print):\n    def g():\n        return print\n",
+			want:   []string{"variable.parameter", "variable.parameter"},
+		},
+		{
+			name:   "non-inheriting scope",
+			source: "def f(print):\n    class C:\n        x = print\n",
+			want:   []string{"variable.parameter", "function.builtin"},
+		},
+		{
+			name:   "used in its own definition value",
+			source: "print = print + 1\nprint\n",
+			want:   []string{"variable", "function.builtin", "variable"},
+		},
+		{
+			name:   "used in its own definition value with an outer definition",
+			source: "def f(print):\n    print = print + 1\n    return print\n",
+			want:   []string{"variable.parameter", "variable", "variable.parameter", "variable"},
+		},
+	}
+
+	cfg := testlang.Config(t, "python")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := highlightNames(t, HighlightEvents(context.Background(), *cfg, tt.source, nil), len(tt.source))
+
+			var got []string
+			for _, match := range printPattern.FindAllStringIndex(tt.source, -1) {
+				got = append(got, names[match[0]])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got highlights %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// goldenLanguages are the languages of the files in testdata/golden, by
+// extension.
+var goldenLanguages = map[string]string{
+	".ejs":  "embedded_template",
+	".html": "html",
+	".py":   "python",
+}
+
+// TestHighlightGolden highlights every source file in testdata/golden and
+// compares the output with the file's .golden file. Run the tests with -update
+// to regenerate the golden files.
+func TestHighlightGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		languageName, ok := goldenLanguages[filepath.Ext(file)]
+		if !ok {
+			continue
+		}
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			source, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Highlighting must not take long, but a layer that is processed over and
+			// over again would make it run forever.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Every highlight names the language of its layer, so that the golden
+			// files show which layer each part of the source is highlighted in.
+			got, err := HighlightContext(ctx, *testlang.Config(t, languageName), string(source), testlang.InjectionCallback(t), func(h types.CaptureIndex, languageName string) string {
+				return fmt.Sprintf(`class="%s %s"`, languageName, testlang.Names[h])
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenFile := file + ".golden"
+			if *update {
+				if err = os.WriteFile(goldenFile, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("highlighted output differs from %s, run the tests with -update to regenerate it:\ngot:\n%s\nwant:\n%s", goldenFile, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package highlight
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
+	ts_iter "github.com/noclaps/go-tree-sitter-highlight/internal/iter"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// defaultHighlighter is used by the package level highlight functions.
+var defaultHighlighter = NewHighlighter()
+
+// Highlighter highlights source code while reusing tree-sitter parsers and
+// query cursors between calls. The pooled resources are kept per language of
+// the [types.Configuration] being highlighted. A Highlighter is safe for
+// concurrent use by multiple goroutines, and should be created once and shared.
+type Highlighter struct {
+	mu     sync.Mutex
+	pool   map[*tree_sitter.Language][]*highlight.Highlighter
+	closed bool
+}
+
+// NewHighlighter creates a new Highlighter with an empty pool.
+func NewHighlighter() *Highlighter {
+	return &Highlighter{
+		pool: make(map[*tree_sitter.Language][]*highlight.Highlighter),
+	}
+}
+
+// Close frees all pooled parsers and cursors. Highlights that are still
+// running release their resources when they finish. The Highlighter can still
+// be used after Close, but nothing will be pooled anymore.
+func (h *Highlighter) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, highlighters := range h.pool {
+		for _, highlighter := range highlighters {
+			highlighter.Close()
+		}
+	}
+	clear(h.pool)
+	h.closed = true
+}
+
+func (h *Highlighter) acquire(language *tree_sitter.Language) *highlight.Highlighter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	highlighters := h.pool[language]
+	if len(highlighters) == 0 {
+		return highlight.NewHighlighter()
+	}
+
+	highlighter := highlighters[len(highlighters)-1]
+	h.pool[language] = highlighters[:len(highlighters)-1]
+	return highlighter
+}
+
+func (h *Highlighter) release(language *tree_sitter.Language, highlighter *highlight.Highlighter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		highlighter.Close()
+		return
+	}
+	h.pool[language] = append(h.pool[language], highlighter)
+}
+
+// Highlight highlights the given source code using the given configuration.
+// The source code is expected to be UTF-8 encoded. The function returns the
+// highlighted HTML or an error.
+func (h *Highlighter) Highlight(cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) (string, error) {
+	return h.HighlightContext(context.Background(), cfg, source, injectionCallback, attributeCallback)
+}
+
+// HighlightContext is like [Highlighter.Highlight], but stops parsing and
+// highlighting as soon as the context is cancelled or its deadline is
+// exceeded. In that case the returned error wraps the context's error.
+func (h *Highlighter) HighlightContext(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) (string, error) {
+	events := h.HighlightEvents(ctx, cfg, source, injectionCallback)
+	return html.Render(events, source, attributeCallback)
+}
+
+// HighlightTo is like [Highlighter.HighlightContext], but streams the
+// highlighted HTML to w instead of building a string. Writes are buffered.
+func (h *Highlighter) HighlightTo(ctx context.Context, w io.Writer, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) error {
+	events := h.HighlightEvents(ctx, cfg, source, injectionCallback)
+	return html.RenderTo(w, events, source, attributeCallback)
+}
+
+// HighlightEvents highlights the given source code using the given
+// configuration and returns the raw stream of highlight events. This can be
+// used to write custom renderers. The stream stops after the first error, or
+// when the context is cancelled.
+func (h *Highlighter) HighlightEvents(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback) iter.Seq2[Event, error] {
+	return h.highlightEvents(ctx, cfg, source, injectionCallback, nil, nil)
+}
+
+// highlightEvents returns the highlight events for the source, or only for
+// the window of it if there is one. Layers whose trees are found in trees are
+// not parsed again.
+func (h *Highlighter) highlightEvents(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, trees highlight.TreeCache, window *Window) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		highlighter := h.acquire(cfg.Language)
+		defer h.release(cfg.Language, highlighter)
+
+		highlighter.Trees = trees
+		defer func() { highlighter.Trees = nil }()
+
+		startByte, endByte := uint(0), uint(len(source))
+		if window != nil {
+			endByte = min(window.EndByte, endByte)
+			startByte = min(window.StartByte, endByte)
+			highlighter.Window = &Window{StartByte: startByte, EndByte: endByte}
+			defer func() { highlighter.Window = nil }()
+		}
+
+		layers, err := ts_iter.NewIterLayers(ctx, []byte(source), "", highlighter, injectionCallback, cfg, 0, []tree_sitter.Range{
+			{
+				StartByte:  0,
+				EndByte:    ^uint(0),
+				StartPoint: tree_sitter.NewPoint(0, 0),
+				EndPoint:   tree_sitter.NewPoint(^uint(0), ^uint(0)),
+			},
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		i := &ts_iter.Iterator{
+			Ctx:                ctx,
+			Source:             []byte(source),
+			LanguageName:       cfg.LanguageName,
+			ByteOffset:         startByte,
+			EndByte:            endByte,
+			Highlighter:        highlighter,
+			InjectionCallback:  injectionCallback,
+			Layers:             layers,
+			NextEvents:         nil,
+			LastHighlightRange: nil,
+		}
+		defer i.Close()
+		i.SortLayers()
+
+		for {
+			event, err := i.Next()
+			if err != nil {
+				yield(nil, err)
+
+				// error we are done
+				return
+			}
+
+			if event == nil {
+				// we're done if there are no more events
+				return
+			}
+
+			// yield the event
+			if !yield(event, nil) {
+				// if the consumer returns false we can stop
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package highlighttest checks highlight queries against test files in
+// tree-sitter's highlight test format, as found in the `test/highlight`
+// directory of grammar repositories.
+//
+// Test files are regular source files with assertion comments. An assertion
+// comment contains an arrow and a capture name, and refers to the closest
+// line above it that isn't an assertion:
+//
+//	func main() {
+//	// <- keyword
+//	//   ^ function
+//	//    ^ !keyword
+//	}
+//
+// A `<-` arrow refers to the column the comment starts at, and a `^` arrow to
+// its own column. Multiple carets like `^^^` refer to multiple columns. A `!`
+// before the capture name asserts that the capture is not there.
+package highlighttest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// Assertion is an expected capture at a position of a test file.
+type Assertion struct {
+	// Position is the position the assertion refers to. The column is in bytes.
+	Position tree_sitter.Point
+	// Length is the number of columns the assertion covers.
+	Length uint
+	// Negative is set if the capture is expected not to be there.
+	Negative bool
+	// CaptureName is the expected capture name.
+	CaptureName string
+}
+
+var captureNameRegex = regexp.MustCompile(`[\w_\-.]+`)
+
+// ParseAssertions parses the source with the given language, and returns the
+// assertions in its comments, sorted by position. Comments are the nodes whose
+// kind contains "comment".
+func ParseAssertions(language *tree_sitter.Language, source []byte) ([]Assertion, error) {
+	parser := tree_sitter.NewParser()
+	defer parser.Close()
+
+	if err := parser.SetLanguage(language); err != nil {
+		return nil, fmt.Errorf("error setting language: %w", err)
+	}
+	tree := parser.Parse(source, nil)
+	if tree == nil {
+		return nil, fmt.Errorf("error parsing test file")
+	}
+	defer tree.Close()
+
+	var (
+		result []Assertion
+		// assertionRows are the rows of all assertion comments.
+		assertionRows []uint
+	)
+
+	cursor := tree.Walk()
+	defer cursor.Close()
+
+	ascending := false
+	for {
+		if !ascending {
+			if !cursor.GotoFirstChild() {
+				ascending = true
+			}
+			continue
+		}
+
+		node := cursor.Node()
+		if strings.Contains(strings.ToLower(node.Kind()), "comment") && node.StartPosition().Row > 0 {
+			if assertion, ok := parseAssertion(node.Utf8Text(source), node.StartPosition()); ok {
+				result = append(result, assertion)
+				assertionRows = append(assertionRows, node.StartPosition().Row)
+			}
+		}
+
+		if cursor.GotoNextSibling() {
+			ascending = false
+		} else if !cursor.GotoParent() {
+			break
+		}
+	}
+
+	// Move each assertion up to the line of code it refers to, skipping other
+	// assertion comments and lines that are too short to contain the column.
+	lines := strings.SplitAfter(string(source), "\n")
+	for i := range result {
+		assertion := &result[i]
+		for slices.Contains(assertionRows, assertion.Position.Row) || uint(len(strings.TrimRight(lines[assertion.Position.Row], "\r\n"))) <= assertion.Position.Column {
+			if assertion.Position.Row == 0 {
+				return nil, fmt.Errorf("assertion at %d:%d doesn't refer to a line of code", assertion.Position.Row+1, assertion.Position.Column+1)
+			}
+			assertion.Position.Row--
+		}
+	}
+
+	slices.SortStableFunc(result, func(a Assertion, b Assertion) int {
+		if a.Position.Row != b.Position.Row {
+			return int(a.Position.Row) - int(b.Position.Row)
+		}
+		return int(a.Position.Column) - int(b.Position.Column)
+	})
+	return result, nil
+}
+
+// parseAssertion parses the text of a comment that starts at the given position.
+func parseAssertion(text string, position tree_sitter.Point) (Assertion, bool) {
+	assertion := Assertion{
+		Position: position,
+		Length:   1,
+	}
+
+	// Find the arrow, either "<-" or one or more "^".
+	rest := ""
+	if i := strings.Index(text, "<-"); i != -1 && (strings.IndexByte(text, '^') == -1 || i < strings.IndexByte(text, '^')) {
+		rest = text[i+len("<-"):]
+	} else if i := strings.IndexByte(text, '^'); i != -1 {
+		assertion.Position.Column += uint(i)
+		carets := len(text[i:]) - len(strings.TrimLeft(text[i:], "^"))
+		assertion.Length = uint(carets)
+		rest = text[i+carets:]
+	} else {
+		return Assertion{}, false
+	}
+
+	// A "!" between the arrow and the capture name makes the assertion negative.
+	rest = strings.TrimLeft(rest, " \t")
+	if after, ok := strings.CutPrefix(rest, "!"); ok {
+		assertion.Negative = true
+		rest = after
+	}
+
+	name := captureNameRegex.FindString(rest)
+	if name == "" {
+		return Assertion{}, false
+	}
+	assertion.CaptureName = name
+	return assertion, true
+}
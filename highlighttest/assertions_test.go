@@ -0,0 +1,98 @@
+package highlighttest
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+func TestParseAssertions(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		want    []Assertion
+		wantErr bool
+	}{
+		{
+			name:   "left arrow",
+			source: "def f():\n# <- keyword\n    pass\n",
+			want: []Assertion{
+				{Position: tree_sitter.NewPoint(0, 0), Length: 1, CaptureName: "keyword"},
+			},
+		},
+		{
+			name:   "caret",
+			source: "def f():\n#   ^ function\n",
+			want: []Assertion{
+				{Position: tree_sitter.NewPoint(0, 4), Length: 1, CaptureName: "function"},
+			},
+		},
+		{
+			name:   "indented caret",
+			source: "x = len(y)\n    # ^^^ function.builtin\n",
+			want: []Assertion{
+				{Position: tree_sitter.NewPoint(0, 6), Length: 3, CaptureName: "function.builtin"},
+			},
+		},
+		{
+			name:   "negative",
+			source: "x = 1\n# <- !keyword\n#   ^ ! number\n",
+			want: []Assertion{
+				{Position: tree_sitter.NewPoint(0, 0), Length: 1, Negative: true, CaptureName: "keyword"},
+				{Position: tree_sitter.NewPoint(0, 4), Length: 1, Negative: true, CaptureName: "number"},
+			},
+		},
+		{
+			name:   "sorted by position",
+			source: "x = 1\n#   ^ number\n# <- variable\ny = 2\n# <- variable\n",
+			want: []Assertion{
+				{Position: tree_sitter.NewPoint(0, 0), Length: 1, CaptureName: "variable"},
+				{Position: tree_sitter.NewPoint(0, 4), Length: 1, CaptureName: "number"},
+				{Position: tree_sitter.NewPoint(3, 0), Length: 1, CaptureName: "variable"},
+			},
+		},
+		{
+			name:   "skips lines that are too short",
+			source: "value = 1\nx\n#       ^ number\n",
+			want: []Assertion{
+				{Position: tree_sitter.NewPoint(0, 8), Length: 1, CaptureName: "number"},
+			},
+		},
+		{
+			name:   "comments without arrow or capture name",
+			source: "# a comment\nx = 1\n# not an assertion\n# <-\n#   ^ \n",
+			want:   nil,
+		},
+		{
+			name:   "comment at the first line",
+			source: "# <- comment\nx = 1\n",
+			want:   nil,
+		},
+		{
+			name:    "no line of code",
+			source:  "\n# <- keyword\n",
+			wantErr: true,
+		},
+	}
+
+	language := testlang.Language("python")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAssertions(language.Lang, []byte(tt.source))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got assertions %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got assertions %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package highlighttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	highlight "github.com/noclaps/go-tree-sitter-highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// Failure is an assertion that doesn't hold.
+type Failure struct {
+	Assertion
+	// Actual are the capture names of all highlights at the position of the assertion.
+	Actual []string
+}
+
+func (f Failure) String() string {
+	expected := f.CaptureName
+	if f.Negative {
+		expected = "not " + expected
+	}
+	return fmt.Sprintf("%d:%d: expected %s, got [%s]", f.Position.Row+1, f.Position.Column+1, expected, strings.Join(f.Actual, ", "))
+}
+
+// Error is returned when a test file has assertions that don't hold.
+type Error struct {
+	Path     string
+	Failures []Failure
+}
+
+func (e *Error) Error() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "%s: %d failed assertions", e.Path, len(e.Failures))
+	for _, failure := range e.Failures {
+		fmt.Fprintf(&message, "\n  %s", failure)
+	}
+	return message.String()
+}
+
+// span is a highlighted byte range of a test file.
+type span struct {
+	start uint
+	end   uint
+	name  string
+}
+
+// Check highlights the source with the given configuration, which must have
+// been created with the given recognised names, and returns the assertions in
+// its comments that don't hold. Capture names are compared with the recognised
+// names the captures resolve to.
+func Check(cfg types.Configuration, recognisedNames []string, source []byte, injectionCallback types.InjectionCallback) ([]Failure, error) {
+	assertions, err := ParseAssertions(cfg.Language, source)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		spans  []span
+		open   []span
+		offset uint
+	)
+	for event, err := range highlight.HighlightEvents(context.Background(), cfg, string(source), injectionCallback) {
+		if err != nil {
+			return nil, err
+		}
+
+		switch e := event.(type) {
+		case highlight.EventCaptureStart:
+			var name string
+			if int(e.Highlight) < len(recognisedNames) {
+				name = recognisedNames[e.Highlight]
+			}
+			open = append(open, span{start: offset, name: name})
+		case highlight.EventCaptureEnd:
+			s := open[len(open)-1]
+			s.end = offset
+			spans = append(spans, s)
+			open = open[:len(open)-1]
+		case highlight.EventSource:
+			offset = e.EndByte
+		}
+	}
+
+	lineStarts := []uint{0}
+	for i, c := range source {
+		if c == '\n' {
+			lineStarts = append(lineStarts, uint(i+1))
+		}
+	}
+
+	var failures []Failure
+	for _, assertion := range assertions {
+		start := lineStarts[assertion.Position.Row] + assertion.Position.Column
+		end := start + assertion.Length
+
+		var actual []string
+		for _, s := range spans {
+			if s.start < end && start < s.end && !slices.Contains(actual, s.name) {
+				actual = append(actual, s.name)
+			}
+		}
+
+		if slices.Contains(actual, assertion.CaptureName) == assertion.Negative {
+			failures = append(failures, Failure{
+				Assertion: assertion,
+				Actual:    actual,
+			})
+		}
+	}
+
+	return failures, nil
+}
+
+// CheckFile runs [Check] on the test file at the given path. If any assertions
+// don't hold, an [*Error] is returned.
+func CheckFile(path string, cfg types.Configuration, recognisedNames []string, injectionCallback types.InjectionCallback) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	failures, err := Check(cfg, recognisedNames, source, injectionCallback)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(failures) > 0 {
+		return &Error{
+			Path:     path,
+			Failures: failures,
+		}
+	}
+	return nil
+}
+
+// CheckDir runs [CheckFile] on every file in the directory and its
+// subdirectories, usually a grammar's `test/highlight` directory. The
+// configuration for each file is looked up with configForPath, e.g.
+// [github.com/noclaps/go-tree-sitter-highlight/language.Registry.ForPath].
+// The errors of all files are joined.
+func CheckDir(dir string, configForPath func(path string) (*types.Configuration, error), recognisedNames []string, injectionCallback types.InjectionCallback) error {
+	var errs []error
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		cfg, err := configForPath(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			return nil
+		}
+		if err := CheckFile(path, *cfg, recognisedNames, injectionCallback); err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
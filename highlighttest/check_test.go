@@ -0,0 +1,51 @@
+package highlighttest
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+func TestCheckDir(t *testing.T) {
+	err := CheckDir("testdata", func(path string) (*types.Configuration, error) {
+		if filepath.Ext(path) != ".py" {
+			return nil, errors.New("unknown language")
+		}
+		return testlang.Config(t, "python"), nil
+	}, testlang.Names, testlang.InjectionCallback(t))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	source := "def f(x):\n#     ^ variable.parameter\n#     ^ keyword\n    return 1\n    # <- !keyword\n    #      ^ number\n"
+	failures, err := Check(*testlang.Config(t, "python"), testlang.Names, []byte(source), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Failure{
+		{
+			Assertion: Assertion{Position: tree_sitter.NewPoint(0, 6), Length: 1, CaptureName: "keyword"},
+			Actual:    []string{"variable.parameter"},
+		},
+		{
+			Assertion: Assertion{Position: tree_sitter.NewPoint(3, 4), Length: 1, Negative: true, CaptureName: "keyword"},
+			Actual:    []string{"keyword"},
+		},
+	}
+	if !slices.EqualFunc(failures, want, func(a Failure, b Failure) bool {
+		return a.Assertion == b.Assertion && slices.Equal(a.Actual, b.Actual)
+	}) {
+		t.Errorf("got failures %+v, want %+v", failures, want)
+	}
+	if got, want := failures[0].String(), "1:7: expected keyword, got [variable.parameter]"; got != want {
+		t.Errorf("got failure %q, want %q", got, want)
+	}
+}
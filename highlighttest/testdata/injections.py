@@ -0,0 +1,7 @@
+exec("len = 1; print(len)")
+# <- function.builtin
+#     ^^^ variable
+#                    ^^^ variable
+#              ^^^^^ function.builtin
+#    ^ string
+#    ^ !variable
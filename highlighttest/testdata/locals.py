@@ -0,0 +1,23 @@
+def scale(value, factor):
+# <- keyword
+#   ^^^^^ function
+#         ^^^^^ variable.parameter
+    print(value * factor)
+    # <- function.builtin
+    #     ^^^^^ variable.parameter
+    #             ^^^^^^ variable.parameter
+
+    def inner():
+        return value
+        #      ^^^^^ variable.parameter
+
+    class Box:
+        size = value
+        #      ^^^^^ variable
+        #      ^^^^^ !variable.parameter
+
+print = scale
+print(1)
+# <- variable
+# <- !function.builtin
+#     ^ number
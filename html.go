@@ -0,0 +1,66 @@
+package highlight
+
+import (
+	"context"
+	"io"
+	"iter"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// HTMLOptions configures line numbers, line anchors and highlighted lines in
+// the output of [RenderHTMLWithOptions]. Its CSS method returns the
+// stylesheet for them.
+type HTMLOptions = html.Options
+
+// LineNumbers is the way line numbers are shown in HTML output.
+type LineNumbers = html.LineNumbers
+
+const (
+	// LineNumbersNone shows no line numbers.
+	LineNumbersNone = html.LineNumbersNone
+	// LineNumbersTable renders a table with a row per line, and the line
+	// numbers in the first column.
+	LineNumbersTable = html.LineNumbersTable
+	// LineNumbersCSS renders an element per line, and shows the line numbers
+	// with a CSS counter.
+	LineNumbersCSS = html.LineNumbersCSS
+)
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange = html.LineRange
+
+// LineRanges is a set of line ranges.
+type LineRanges = html.LineRanges
+
+// ParseLineRanges parses line ranges like `{3-5,9}` or `3-5,9`.
+func ParseLineRanges(s string) (LineRanges, error) {
+	return html.ParseLineRanges(s)
+}
+
+// RenderHTMLWithOptions renders a stream of highlight events like
+// [RenderHTML], with every line wrapped in its own element when line numbers,
+// line anchors or highlighted lines are used. Every line element has a
+// `data-line` attribute with its number, and an `id` like `L42` if
+// [HTMLOptions.LineAnchors] is set.
+//
+// If [HTMLOptions.NodeAttributeCallback] is set, it is used instead of the
+// attribute callback, and gets the captured node of every highlight, so it
+// can add tooltips, metadata or links.
+func RenderHTMLWithOptions(w io.Writer, events iter.Seq2[Event, error], source string, attributeCallback types.AttributeCallback, options HTMLOptions) error {
+	return html.RenderWithOptions(w, events, source, attributeCallback, options)
+}
+
+// HighlightHTML highlights the given source code and writes it to w as HTML.
+// See [RenderHTMLWithOptions].
+func HighlightHTML(ctx context.Context, w io.Writer, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback, options HTMLOptions) error {
+	return defaultHighlighter.HighlightHTML(ctx, w, cfg, source, injectionCallback, attributeCallback, options)
+}
+
+// HighlightHTML highlights the given source code and writes it to w as HTML.
+// See [RenderHTMLWithOptions].
+func (h *Highlighter) HighlightHTML(ctx context.Context, w io.Writer, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback, options HTMLOptions) error {
+	events := h.HighlightEvents(ctx, cfg, source, injectionCallback)
+	return RenderHTMLWithOptions(w, events, source, attributeCallback, options)
+}
@@ -0,0 +1,260 @@
+package ansi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/lines"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+const (
+	reset = "\x1b[0m"
+	faint = "\x1b[2m"
+)
+
+type renderer struct {
+	w        *bufio.Writer
+	err      error
+	callback types.StyleCallback
+	depth    ColorDepth
+	// lineEndings is how carriage returns are written.
+	lineEndings types.LineEndings
+	layout      lines.Layout
+	// styles holds the effective style of every open highlight, with the
+	// styles of the enclosing highlights applied.
+	styles []types.Style
+}
+
+func (r *renderer) writeString(s string) {
+	if r.err != nil {
+		return
+	}
+	_, r.err = r.w.WriteString(s)
+}
+
+// current returns the effective style of the innermost open highlight.
+func (r *renderer) current() types.Style {
+	if len(r.styles) == 0 {
+		return types.Style{}
+	}
+	return r.styles[len(r.styles)-1]
+}
+
+func (r *renderer) startHighlight(h types.CaptureIndex, languageName string) {
+	var style types.Style
+	if r.callback != nil {
+		style = r.callback(h, languageName)
+	}
+
+	outer := r.current()
+	if style.Foreground == nil {
+		style.Foreground = outer.Foreground
+	}
+	if style.Background == nil {
+		style.Background = outer.Background
+	}
+	style.Bold = style.Bold || outer.Bold
+	style.Italic = style.Italic || outer.Italic
+	style.Underline = style.Underline || outer.Underline
+	style.Strikethrough = style.Strikethrough || outer.Strikethrough
+
+	r.styles = append(r.styles, style)
+	if sequence := sgr(style, r.depth); sequence != sgr(outer, r.depth) {
+		r.writeString(sequence)
+	}
+}
+
+func (r *renderer) endHighlight() {
+	closed := r.current()
+	r.styles = r.styles[:len(r.styles)-1]
+
+	// There is no general way to turn off a single attribute, so reset
+	// everything and apply the style of the enclosing highlight again. Styles
+	// that look the same at the color depth don't need it.
+	if sequence := sgr(r.current(), r.depth); sgr(closed, r.depth) != sequence {
+		r.writeString(reset)
+		r.writeString(sequence)
+	}
+}
+
+// addText writes the source from start to end.
+func (r *renderer) addText(source string, start int, end int) {
+	special := "\r\n"
+	if r.layout.Active() {
+		special = "\r\n \t"
+	}
+
+	for start < end {
+		i := strings.IndexAny(source[start:end], special)
+		if i == -1 {
+			r.writeText(source, start, end)
+			return
+		}
+		i += start
+		r.writeText(source, start, i)
+		start = i + 1
+
+		if source[i] == ' ' || source[i] == '\t' {
+			r.addWhitespace(source, i)
+			continue
+		}
+
+		text, lineBreak := "\n", true
+		if source[i] == '\r' {
+			text, lineBreak = lines.CarriageReturn(r.lineEndings, source, i)
+		}
+		if !lineBreak {
+			r.layout.Replaced(source, i, text)
+			r.writeString(text)
+			continue
+		}
+		r.layout.LineBreak(i)
+
+		// Reset at line breaks, so that backgrounds don't extend to the end
+		// of the terminal line, and every line can be printed on its own.
+		sequence := sgr(r.current(), r.depth)
+		if sequence != "" {
+			r.writeString(reset)
+		}
+		r.writeString(text)
+		r.writeString(sequence)
+	}
+}
+
+// writeText writes text without line breaks, or tabs and spaces that need the layout.
+func (r *renderer) writeText(source string, start int, end int) {
+	r.layout.Text(source, start, end)
+	r.writeString(source[start:end])
+}
+
+// addWhitespace writes the tab or space at offset i. Marked whitespace is
+// written faint, and then the current style is applied again.
+func (r *renderer) addWhitespace(source string, i int) {
+	text, kinds := r.layout.Whitespace(source, i)
+	if len(kinds) == 0 {
+		r.writeString(text)
+		return
+	}
+
+	r.writeString(faint)
+	r.writeString(text)
+	r.writeString(reset)
+	r.writeString(sgr(r.current(), r.depth))
+}
+
+// sgr returns the SGR escape sequence that sets the given style, or an empty
+// string if the style is empty.
+func sgr(style types.Style, depth ColorDepth) string {
+	var params []string
+	if style.Bold {
+		params = append(params, "1")
+	}
+	if style.Italic {
+		params = append(params, "3")
+	}
+	if style.Underline {
+		params = append(params, "4")
+	}
+	if style.Strikethrough {
+		params = append(params, "9")
+	}
+	if style.Foreground != nil {
+		params = append(params, colorParams(*style.Foreground, depth, false)...)
+	}
+	if style.Background != nil {
+		params = append(params, colorParams(*style.Background, depth, true)...)
+	}
+
+	if len(params) == 0 {
+		return ""
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+func colorParams(c types.Color, depth ColorDepth, background bool) []string {
+	switch depth {
+	case ColorDepthTrueColor:
+		selector := "38"
+		if background {
+			selector = "48"
+		}
+		return []string{selector, "2", strconv.Itoa(int(c.R)), strconv.Itoa(int(c.G)), strconv.Itoa(int(c.B))}
+	case ColorDepth256:
+		selector := "38"
+		if background {
+			selector = "48"
+		}
+		return []string{selector, "5", strconv.Itoa(int(to256(c)))}
+	case ColorDepth16:
+		i := to16(c)
+		base := 30
+		if background {
+			base = 40
+		}
+		if i >= 8 {
+			base += 60
+			i -= 8
+		}
+		return []string{strconv.Itoa(base + int(i))}
+	default:
+		return nil
+	}
+}
+
+// Render renders the code to w, with ANSI escape sequences for the style of each highlight capture.
+// The [StyleCallback] is used to get the style for each highlight.
+func Render(w io.Writer, highlightEvents iter.Seq2[events.Event, error], source string, callback types.StyleCallback, depth ColorDepth, lineEndings types.LineEndings, whitespace types.Whitespace) error {
+	// Terminals can only show marked whitespace with glyphs.
+	whitespace.Glyphs = true
+
+	if depth == ColorDepthAuto {
+		depth = DetectColorDepth()
+	}
+
+	r := &renderer{
+		w:           bufio.NewWriter(w),
+		callback:    callback,
+		depth:       depth,
+		lineEndings: lineEndings,
+		layout:      lines.NewLayout(whitespace),
+	}
+
+	var languages []string
+	for event, err := range highlightEvents {
+		if err != nil {
+			if len(r.styles) > 0 {
+				r.writeString(reset)
+			}
+			r.w.Flush()
+			return fmt.Errorf("error while rendering: %w", err)
+		}
+
+		switch e := event.(type) {
+		case events.EventLayerStart:
+			languages = append(languages, e.LanguageName)
+		case events.EventLayerEnd:
+			languages = languages[:len(languages)-1]
+		case events.EventCaptureStart:
+			r.startHighlight(e.Highlight, languages[len(languages)-1])
+		case events.EventCaptureEnd:
+			r.endHighlight()
+		case events.EventSource:
+			r.addText(source, int(e.StartByte), int(e.EndByte))
+		}
+
+		if r.err != nil {
+			return fmt.Errorf("error while writing: %w", r.err)
+		}
+	}
+
+	if err := r.w.Flush(); err != nil {
+		return fmt.Errorf("error while writing: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package ansi
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// testNames are the names of the highlights in the events of the tests.
+var testNames = []string{"bold", "red", "blue", "plain", "on-gray"}
+
+var (
+	red  = types.Color{R: 255}
+	blue = types.Color{B: 255}
+	gray = types.Color{R: 128, G: 128, B: 128}
+)
+
+func testStyle(h types.CaptureIndex, languageName string) types.Style {
+	switch testNames[h] {
+	case "bold":
+		return types.Style{Bold: true}
+	case "red":
+		return types.Style{Foreground: &red}
+	case "blue":
+		return types.Style{Foreground: &blue}
+	case "on-gray":
+		return types.Style{Background: &gray}
+	default:
+		return types.Style{}
+	}
+}
+
+func layerStart(languageName string) events.Event {
+	return events.EventLayerStart{LanguageName: languageName}
+}
+
+func captureStart(name string) events.Event {
+	return events.EventCaptureStart{Highlight: types.CaptureIndex(slices.Index(testNames, name)), Name: name}
+}
+
+func text(start uint, end uint) events.Event {
+	return events.EventSource{StartByte: start, EndByte: end}
+}
+
+var captureEnd events.Event = events.EventCaptureEnd{}
+
+func seq(highlightEvents ...events.Event) iter.Seq2[events.Event, error] {
+	return func(yield func(events.Event, error) bool) {
+		for _, event := range highlightEvents {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		events      []events.Event
+		depth       ColorDepth
+		lineEndings types.LineEndings
+		whitespace  types.Whitespace
+		want        string
+	}{
+		{
+			name:   "styles",
+			source: "a b",
+			events: []events.Event{layerStart("go"), captureStart("bold"), text(0, 1), captureEnd, text(1, 2), captureStart("red"), text(2, 3), captureEnd},
+			depth:  ColorDepthTrueColor,
+			want:   "\x1b[1ma\x1b[0m \x1b[38;2;255;0;0mb\x1b[0m",
+		},
+		{
+			// The inner highlight inherits the bold, and ending it resets the
+			// style and applies the bold of the outer highlight again.
+			name:   "nested highlights",
+			source: "abc",
+			events: []events.Event{layerStart("go"), captureStart("bold"), text(0, 1), captureStart("red"), text(1, 2), captureEnd, text(2, 3), captureEnd},
+			depth:  ColorDepthTrueColor,
+			want:   "\x1b[1ma\x1b[1;38;2;255;0;0mb\x1b[0m\x1b[1mc\x1b[0m",
+		},
+		{
+			name:   "nested colors",
+			source: "abc",
+			events: []events.Event{layerStart("go"), captureStart("red"), text(0, 1), captureStart("blue"), text(1, 2), captureEnd, text(2, 3), captureEnd},
+			depth:  ColorDepth256,
+			want:   "\x1b[38;5;196ma\x1b[38;5;21mb\x1b[0m\x1b[38;5;196mc\x1b[0m",
+		},
+		{
+			// A highlight without a style doesn't change the output.
+			name:   "unstyled highlight",
+			source: "ab",
+			events: []events.Event{layerStart("go"), captureStart("plain"), text(0, 1), captureEnd, text(1, 2)},
+			depth:  ColorDepthTrueColor,
+			want:   "ab",
+		},
+		{
+			name:   "unstyled highlight in a styled one",
+			source: "abc",
+			events: []events.Event{layerStart("go"), captureStart("bold"), text(0, 1), captureStart("plain"), text(1, 2), captureEnd, text(2, 3), captureEnd},
+			depth:  ColorDepth16,
+			want:   "\x1b[1mabc\x1b[0m",
+		},
+		{
+			name:   "line breaks",
+			source: "a\nb\r\nc",
+			events: []events.Event{layerStart("go"), captureStart("on-gray"), text(0, 6), captureEnd},
+			depth:  ColorDepth16,
+			want:   "\x1b[100ma\x1b[0m\n\x1b[100mb\x1b[0m\n\x1b[100mc\x1b[0m",
+		},
+		{
+			name:        "visible carriage returns",
+			source:      "a\r\nb",
+			events:      []events.Event{layerStart("go"), captureStart("red"), text(0, 4), captureEnd},
+			depth:       ColorDepth16,
+			lineEndings: types.LineEndingsVisible,
+			want:        "\x1b[91ma␍\x1b[0m\n\x1b[91mb\x1b[0m",
+		},
+		{
+			// Colors aren't written without colors, so they don't need a reset.
+			name:   "no colors",
+			source: "a b",
+			events: []events.Event{layerStart("go"), captureStart("bold"), text(0, 1), captureEnd, text(1, 2), captureStart("red"), text(2, 3), captureEnd},
+			depth:  ColorDepthNone,
+			want:   "\x1b[1ma\x1b[0m b",
+		},
+		{
+			name:       "marked whitespace",
+			source:     "a\tb ",
+			events:     []events.Event{layerStart("go"), captureStart("bold"), text(0, 4), captureEnd},
+			depth:      ColorDepth16,
+			whitespace: types.Whitespace{TabWidth: 4, Trailing: true},
+			want:       "\x1b[1ma   b\x1b[2m·\x1b[0m\x1b[1m\x1b[0m",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Render(&out, seq(tt.events...), tt.source, testStyle, tt.depth, tt.lineEndings, tt.whitespace); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	errTest := errors.New("test error")
+	highlightEvents := func(yield func(events.Event, error) bool) {
+		_ = yield(layerStart("go"), nil) && yield(captureStart("bold"), nil) && yield(text(0, 1), nil) && yield(nil, errTest)
+	}
+
+	var out bytes.Buffer
+	err := Render(&out, highlightEvents, "a", testStyle, ColorDepth16, types.LineEndingsNormalize, types.Whitespace{})
+	if !errors.Is(err, errTest) {
+		t.Errorf("got error %v, want %v", err, errTest)
+	}
+	// The output is reset, so the terminal isn't left bold.
+	if want := "\x1b[1ma\x1b[0m"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
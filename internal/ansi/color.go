@@ -0,0 +1,118 @@
+package ansi
+
+import (
+	"os"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// ColorDepth is the number of colors a terminal supports.
+type ColorDepth int
+
+const (
+	// ColorDepthAuto detects the color depth from the environment.
+	ColorDepthAuto ColorDepth = iota
+	// ColorDepthNone prints no colors, only text attributes like bold.
+	ColorDepthNone
+	// ColorDepth16 uses the 16 standard terminal colors.
+	ColorDepth16
+	// ColorDepth256 uses the xterm 256-color palette.
+	ColorDepth256
+	// ColorDepthTrueColor uses 24-bit colors.
+	ColorDepthTrueColor
+)
+
+// DetectColorDepth detects the color depth of the terminal from the
+// `NO_COLOR`, `COLORTERM` and `TERM` environment variables.
+func DetectColorDepth() ColorDepth {
+	if os.Getenv("NO_COLOR") != "" {
+		return ColorDepthNone
+	}
+
+	switch strings.ToLower(os.Getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return ColorDepthTrueColor
+	}
+
+	term := os.Getenv("TERM")
+	switch {
+	case term == "dumb":
+		return ColorDepthNone
+	case strings.Contains(term, "256color"):
+		return ColorDepth256
+	default:
+		return ColorDepth16
+	}
+}
+
+// palette16 are the xterm default values of the 16 standard colors.
+var palette16 = [16]types.Color{
+	rgb(0, 0, 0), rgb(205, 0, 0), rgb(0, 205, 0), rgb(205, 205, 0),
+	rgb(0, 0, 238), rgb(205, 0, 205), rgb(0, 205, 205), rgb(229, 229, 229),
+	rgb(127, 127, 127), rgb(255, 0, 0), rgb(0, 255, 0), rgb(255, 255, 0),
+	rgb(92, 92, 255), rgb(255, 0, 255), rgb(0, 255, 255), rgb(255, 255, 255),
+}
+
+func rgb(r uint8, g uint8, b uint8) types.Color {
+	return types.Color{R: r, G: g, B: b}
+}
+
+// cubeLevels are the values of each channel in the 6x6x6 color cube of the 256-color palette.
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// to16 returns the index of the nearest of the 16 standard colors.
+func to16(c types.Color) uint8 {
+	var best uint8
+	bestDistance := -1
+	for i, p := range palette16 {
+		if d := distance(c, p); bestDistance == -1 || d < bestDistance {
+			best = uint8(i)
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// to256 returns the index of the nearest color in the 256-color palette,
+// considering the color cube and the grayscale ramp.
+func to256(c types.Color) uint8 {
+	r, g, b := nearestLevel(c.R), nearestLevel(c.G), nearestLevel(c.B)
+	cube := types.Color{R: cubeLevels[r], G: cubeLevels[g], B: cubeLevels[b]}
+	cubeIndex := 16 + 36*r + 6*g + b
+
+	// The grayscale ramp goes from 8 to 238 in steps of 10.
+	average := (int(c.R) + int(c.G) + int(c.B)) / 3
+	grayStep := min(max((average-8+5)/10, 0), 23)
+	grayLevel := uint8(8 + 10*grayStep)
+	gray := types.Color{R: grayLevel, G: grayLevel, B: grayLevel}
+
+	if distance(c, gray) < distance(c, cube) {
+		return uint8(232 + grayStep)
+	}
+	return cubeIndex
+}
+
+func nearestLevel(v uint8) uint8 {
+	var best uint8
+	for i, level := range cubeLevels {
+		if absDiff(v, level) < absDiff(v, cubeLevels[best]) {
+			best = uint8(i)
+		}
+	}
+	return best
+}
+
+func absDiff(a uint8, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func distance(a types.Color, b types.Color) int {
+	dr := absDiff(a.R, b.R)
+	dg := absDiff(a.G, b.G)
+	db := absDiff(a.B, b.B)
+	return dr*dr + dg*dg + db*db
+}
@@ -0,0 +1,111 @@
+package ansi
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+func TestColorParams(t *testing.T) {
+	tests := []struct {
+		name       string
+		color      types.Color
+		depth      ColorDepth
+		background bool
+		want       []string
+	}{
+		{name: "truecolor", color: rgb(198, 120, 221), depth: ColorDepthTrueColor, want: []string{"38", "2", "198", "120", "221"}},
+		{name: "truecolor background", color: rgb(1, 2, 3), depth: ColorDepthTrueColor, background: true, want: []string{"48", "2", "1", "2", "3"}},
+		{name: "256 cube", color: rgb(198, 120, 221), depth: ColorDepth256, want: []string{"38", "5", "176"}},
+		{name: "256 gray", color: rgb(128, 128, 128), depth: ColorDepth256, background: true, want: []string{"48", "5", "244"}},
+		{name: "16", color: rgb(200, 10, 10), depth: ColorDepth16, want: []string{"31"}},
+		{name: "16 bright", color: rgb(250, 250, 90), depth: ColorDepth16, want: []string{"93"}},
+		{name: "16 background", color: rgb(0, 0, 200), depth: ColorDepth16, background: true, want: []string{"44"}},
+		{name: "16 bright background", color: rgb(255, 255, 255), depth: ColorDepth16, background: true, want: []string{"107"}},
+		{name: "none", color: rgb(255, 0, 0), depth: ColorDepthNone, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := colorParams(tt.color, tt.depth, tt.background); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTo256(t *testing.T) {
+	tests := []struct {
+		color types.Color
+		want  uint8
+	}{
+		{color: rgb(0, 0, 0), want: 16},
+		{color: rgb(255, 255, 255), want: 231},
+		{color: rgb(255, 0, 0), want: 196},
+		{color: rgb(95, 135, 175), want: 67},
+		{color: rgb(100, 130, 180), want: 67},
+		{color: rgb(128, 128, 128), want: 244},
+		{color: rgb(8, 8, 8), want: 232},
+		{color: rgb(238, 238, 238), want: 255},
+		// Near-grays use the grayscale ramp if it is closer than the cube.
+		{color: rgb(30, 30, 32), want: 234},
+	}
+	for _, tt := range tests {
+		if got := to256(tt.color); got != tt.want {
+			t.Errorf("to256(%v) = %d, want %d", tt.color, got, tt.want)
+		}
+	}
+}
+
+func TestTo16(t *testing.T) {
+	// Every color of the palette maps to itself.
+	for i, c := range palette16 {
+		if got := to16(c); got != uint8(i) {
+			t.Errorf("to16(%v) = %d, want %d", c, got, i)
+		}
+	}
+
+	tests := []struct {
+		color types.Color
+		want  uint8
+	}{
+		{color: rgb(10, 10, 10), want: 0},
+		{color: rgb(180, 20, 20), want: 1},
+		{color: rgb(240, 30, 30), want: 9},
+		{color: rgb(100, 100, 255), want: 12},
+		{color: rgb(140, 140, 140), want: 8},
+	}
+	for _, tt := range tests {
+		if got := to16(tt.color); got != tt.want {
+			t.Errorf("to16(%v) = %d, want %d", tt.color, got, tt.want)
+		}
+	}
+}
+
+func TestDetectColorDepth(t *testing.T) {
+	tests := []struct {
+		name      string
+		noColor   string
+		colorTerm string
+		term      string
+		want      ColorDepth
+	}{
+		{name: "no color", noColor: "1", colorTerm: "truecolor", term: "xterm-256color", want: ColorDepthNone},
+		{name: "truecolor", colorTerm: "truecolor", term: "xterm", want: ColorDepthTrueColor},
+		{name: "24bit", colorTerm: "24BIT", want: ColorDepthTrueColor},
+		{name: "256", term: "xterm-256color", want: ColorDepth256},
+		{name: "dumb", term: "dumb", want: ColorDepthNone},
+		{name: "16", term: "xterm", want: ColorDepth16},
+		{name: "unset", want: ColorDepth16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("COLORTERM", tt.colorTerm)
+			t.Setenv("TERM", tt.term)
+			if got := DetectColorDepth(); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// New creates a new highlight configuration for a language from its queries and a list of recognised names.
+// Errors in the queries are returned as a [*QueryError].
+func New(
+	language *tree_sitter.Language,
+	languageName string,
+	highlightsQuery []byte,
+	injectionQuery []byte,
+	localsQuery []byte,
+	recognisedNames []string,
+) (*types.Configuration, error) {
+	querySource := slices.Clone(injectionQuery)
+	localsQueryOffset := uint(len(querySource))
+	querySource = append(querySource, localsQuery...)
+	highlightsQueryOffset := uint(len(querySource))
+	querySource = append(querySource, highlightsQuery...)
+
+	sources := newQuerySources(highlightsQuery, injectionQuery, localsQuery)
+	query, queryErr := tree_sitter.NewQuery(language, string(querySource))
+	if queryErr != nil {
+		return nil, sources.newQueryError(queryErr)
+	}
+
+	localsPatternIndex := uint(0)
+	highlightsPatternIndex := uint(0)
+	for i := range query.PatternCount() {
+		patternOffset := query.StartByteForPattern(i)
+		if patternOffset < highlightsQueryOffset {
+			if patternOffset < highlightsQueryOffset {
+				highlightsPatternIndex++
+			}
+			if patternOffset < localsQueryOffset {
+				localsPatternIndex++
+			}
+		}
+	}
+
+	combinedInjectionsQuery, queryErr := tree_sitter.NewQuery(language, string(injectionQuery))
+	if queryErr != nil {
+		return nil, sources[:1].newQueryError(queryErr)
+	}
+	var hasCombinedQueries bool
+	for i := range localsPatternIndex {
+		settings := combinedInjectionsQuery.PropertySettings(i)
+		if slices.ContainsFunc(settings, func(setting tree_sitter.QueryProperty) bool {
+			return setting.Key == highlight.CaptureInjectionCombined
+		}) {
+			hasCombinedQueries = true
+			query.DisablePattern(i)
+		} else {
+			combinedInjectionsQuery.DisablePattern(i)
+		}
+	}
+	if !hasCombinedQueries {
+		combinedInjectionsQuery = nil
+	}
+
+	// Patterns with a `(#is-not? local)` predicate don't apply to local variables.
+	nonLocalVariablePatterns := make([]bool, query.PatternCount())
+	for i := range query.PatternCount() {
+		predicates := query.PropertyPredicates(i)
+		nonLocalVariablePatterns[i] = slices.ContainsFunc(predicates, func(predicate tree_sitter.PropertyPredicate) bool {
+			return !predicate.Positive && predicate.Property.Key == highlight.CaptureLocal
+		})
+	}
+
+	var (
+		injectionContentCaptureIndex  *uint
+		injectionLanguageCaptureIndex *uint
+		localDefCaptureIndex          *uint
+		localDefValueCaptureIndex     *uint
+		localRefCaptureIndex          *uint
+		localScopeCaptureIndex        *uint
+	)
+
+	for i, captureName := range query.CaptureNames() {
+		ui := uint(i)
+		switch captureName {
+		case "injection.content":
+			injectionContentCaptureIndex = &ui
+		case "injection.language":
+			injectionLanguageCaptureIndex = &ui
+		case "local.definition":
+			localDefCaptureIndex = &ui
+		case "local.definition-value":
+			localDefValueCaptureIndex = &ui
+		case "local.reference":
+			localRefCaptureIndex = &ui
+		case "local.scope":
+			localScopeCaptureIndex = &ui
+		}
+	}
+
+	highlightIndices := make([]*types.CaptureIndex, len(query.CaptureNames()))
+	for i, captureName := range query.CaptureNames() {
+		for {
+			j := slices.Index(recognisedNames, captureName)
+			if j != -1 {
+				index := types.CaptureIndex(j)
+				highlightIndices[i] = &index
+				break
+			}
+
+			lastDot := strings.LastIndex(captureName, ".")
+			if lastDot == -1 {
+				break
+			}
+			captureName = captureName[:lastDot]
+		}
+	}
+
+	return &types.Configuration{
+		Language:                      language,
+		LanguageName:                  languageName,
+		Query:                         query,
+		CombinedInjectionsQuery:       combinedInjectionsQuery,
+		LocalsPatternIndex:            localsPatternIndex,
+		HighlightsPatternIndex:        highlightsPatternIndex,
+		HighlightIndices:              highlightIndices,
+		RecognisedNames:               slices.Clone(recognisedNames),
+		NonLocalVariablePatterns:      nonLocalVariablePatterns,
+		InjectionContentCaptureIndex:  injectionContentCaptureIndex,
+		InjectionLanguageCaptureIndex: injectionLanguageCaptureIndex,
+		LocalScopeCaptureIndex:        localScopeCaptureIndex,
+		LocalDefCaptureIndex:          localDefCaptureIndex,
+		LocalDefValueCaptureIndex:     localDefValueCaptureIndex,
+		LocalRefCaptureIndex:          localRefCaptureIndex,
+	}, nil
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// QueryError is an error in one of the queries of a language, with its
+// position in that query rather than in the combined query.
+type QueryError struct {
+	// File is the query with the error: `highlights`, `injections` or
+	// `locals`. It is empty for errors that aren't in a query, like an
+	// incompatible language version.
+	File string
+	// Line is the 1-based line of the error in the query.
+	Line int
+	// Column is the 1-based byte column of the error in its line.
+	Column int
+	// Offset is the byte offset of the error in the query.
+	Offset uint
+	// Kind is the kind of error.
+	Kind tree_sitter.QueryErrorKind
+	// Message is the message from tree-sitter, like the invalid node type or
+	// capture name.
+	Message string
+	// Snippet is the line of the query with the error.
+	Snippet string
+}
+
+var queryErrorKinds = map[tree_sitter.QueryErrorKind]string{
+	tree_sitter.QueryErrorSyntax:    "invalid syntax",
+	tree_sitter.QueryErrorNodeType:  "invalid node type",
+	tree_sitter.QueryErrorField:     "invalid field name",
+	tree_sitter.QueryErrorCapture:   "invalid capture name",
+	tree_sitter.QueryErrorPredicate: "invalid predicate",
+	tree_sitter.QueryErrorStructure: "impossible pattern",
+	tree_sitter.QueryErrorLanguage:  "incompatible language",
+}
+
+func (e *QueryError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("error creating query: %s", e.Message)
+	}
+
+	message := e.Message
+	switch e.Kind {
+	case tree_sitter.QueryErrorSyntax, tree_sitter.QueryErrorStructure:
+		// The message is the line with a marker, which is in the snippet already.
+		message = ""
+	case tree_sitter.QueryErrorNodeType, tree_sitter.QueryErrorField, tree_sitter.QueryErrorCapture:
+		message = fmt.Sprintf("%q", message)
+	}
+	if message != "" {
+		message = ": " + message
+	}
+	return fmt.Sprintf("error in %s query at line %d, column %d: %s%s\n\t%s", e.File, e.Line, e.Column, queryErrorKinds[e.Kind], message, e.Snippet)
+}
+
+// QueryWarning is a possible mistake in one of the queries of a language,
+// which doesn't stop it from being used.
+type QueryWarning struct {
+	// File is the query of the warning: `highlights`, `injections` or `locals`.
+	File string
+	// Line is the 1-based line of the pattern in the query.
+	Line int
+	// Column is the 1-based byte column of the pattern in its line.
+	Column int
+	// Message describes the problem.
+	Message string
+	// Snippet is the first line of the pattern.
+	Snippet string
+}
+
+func (w QueryWarning) String() string {
+	return fmt.Sprintf("%s query at line %d, column %d: %s\n\t%s", w.File, w.Line, w.Column, w.Message, w.Snippet)
+}
+
+// queryFile is one of the query files that are combined into the query of a configuration.
+type queryFile struct {
+	name   string
+	source []byte
+}
+
+// querySources are the query files of a configuration, in the order they are combined.
+type querySources []queryFile
+
+func newQuerySources(highlightsQuery []byte, injectionQuery []byte, localsQuery []byte) querySources {
+	return querySources{
+		{name: "injections", source: injectionQuery},
+		{name: "locals", source: localsQuery},
+		{name: "highlights", source: highlightsQuery},
+	}
+}
+
+// locate returns the query file of an offset in the combined query, and the offset in that file.
+func (s querySources) locate(offset uint) (queryFile, uint) {
+	for _, file := range s[:len(s)-1] {
+		if offset < uint(len(file.source)) {
+			return file, offset
+		}
+		offset -= uint(len(file.source))
+	}
+	return s[len(s)-1], offset
+}
+
+// rowOffset returns the offset of the start of the 0-based row in the combined query.
+func (s querySources) rowOffset(row uint) uint {
+	var offset uint
+	for _, file := range s {
+		for _, c := range file.source {
+			if row == 0 {
+				return offset
+			}
+			offset++
+			if c == '\n' {
+				row--
+			}
+		}
+	}
+	return offset
+}
+
+// position returns the 1-based line and column of an offset in a query file, and its line.
+func position(source []byte, offset uint) (int, int, string) {
+	offset = min(offset, uint(len(source)))
+	lineStart := bytes.LastIndexByte(source[:offset], '\n') + 1
+	lineEnd := bytes.IndexByte(source[lineStart:], '\n')
+	if lineEnd == -1 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += lineStart
+	}
+	line := bytes.Count(source[:lineStart], []byte{'\n'}) + 1
+	return line, int(offset) - lineStart + 1, string(bytes.TrimRight(source[lineStart:lineEnd], "\r"))
+}
+
+// newQueryError converts an error for the combined query into an error for one of its files.
+func (s querySources) newQueryError(err *tree_sitter.QueryError) *QueryError {
+	if err.Kind == tree_sitter.QueryErrorLanguage {
+		return &QueryError{
+			Kind:    err.Kind,
+			Message: err.Message,
+		}
+	}
+
+	offset := err.Offset
+	if err.Kind == tree_sitter.QueryErrorPredicate {
+		// Predicate errors only have the row of their pattern.
+		offset = s.rowOffset(err.Row)
+	}
+
+	file, fileOffset := s.locate(offset)
+	line, column, snippet := position(file.source, fileOffset)
+	return &QueryError{
+		File:    file.name,
+		Line:    line,
+		Column:  column,
+		Offset:  fileOffset,
+		Kind:    err.Kind,
+		Message: err.Message,
+		Snippet: snippet,
+	}
+}
+
+// warning returns a warning for the pattern at an offset in the combined query.
+func (s querySources) warning(offset uint, format string, args ...any) QueryWarning {
+	file, fileOffset := s.locate(offset)
+	line, column, snippet := position(file.source, fileOffset)
+	return QueryWarning{
+		File:    file.name,
+		Line:    line,
+		Column:  column,
+		Message: fmt.Sprintf(format, args...),
+		Snippet: snippet,
+	}
+}
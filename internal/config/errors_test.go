@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestQuerySourcesLocate(t *testing.T) {
+	sources := newQuerySources([]byte("(c)\n"), []byte("(a)\n(b)\n"), nil)
+	tests := []struct {
+		offset     uint
+		wantFile   string
+		wantOffset uint
+	}{
+		{offset: 0, wantFile: "injections", wantOffset: 0},
+		{offset: 7, wantFile: "injections", wantOffset: 7},
+		// The locals query is empty, so the offset after the injections query is
+		// in the highlights query.
+		{offset: 8, wantFile: "highlights", wantOffset: 0},
+		{offset: 10, wantFile: "highlights", wantOffset: 2},
+		// Offsets past the end are at the end of the last query.
+		{offset: 12, wantFile: "highlights", wantOffset: 4},
+	}
+	for _, tt := range tests {
+		file, offset := sources.locate(tt.offset)
+		if file.name != tt.wantFile || offset != tt.wantOffset {
+			t.Errorf("got %s at %d for offset %d, want %s at %d", file.name, offset, tt.offset, tt.wantFile, tt.wantOffset)
+		}
+	}
+}
+
+func TestQuerySourcesRowOffset(t *testing.T) {
+	sources := newQuerySources([]byte("(c)\n(d)\n"), []byte("(a)\n"), []byte("(b)\n"))
+	for row, want := range []uint{0, 4, 8, 12, 16} {
+		if got := sources.rowOffset(uint(row)); got != want {
+			t.Errorf("got offset %d for row %d, want %d", got, row, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+var (
+	queryComment = regexp.MustCompile(`;[^\n]*`)
+	captureName  = regexp.MustCompile(`@[\w.\-]+`)
+	whitespace   = regexp.MustCompile(`\s+`)
+)
+
+// Validate creates a configuration like [New], and returns warnings about possible mistakes in its
+// queries:
+//   - capture names in the highlights query that match no recognised name, so they are never
+//     highlighted. Names starting with `_` are only used in predicates and are skipped.
+//   - highlights patterns that are overridden by an identical later pattern, one that is the same
+//     except for its capture names, comments and whitespace. Later patterns win for the same node.
+//     Only identical patterns are detected, not ones that a later pattern overrides for some of the
+//     nodes they match.
+//   - injection patterns without an `@injection.content` capture, which never inject anything.
+func Validate(
+	language *tree_sitter.Language,
+	languageName string,
+	highlightsQuery []byte,
+	injectionQuery []byte,
+	localsQuery []byte,
+	recognisedNames []string,
+) ([]QueryWarning, error) {
+	cfg, err := New(language, languageName, highlightsQuery, injectionQuery, localsQuery, recognisedNames)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		cfg.Query.Close()
+		if cfg.CombinedInjectionsQuery != nil {
+			cfg.CombinedInjectionsQuery.Close()
+		}
+	}()
+
+	sources := newQuerySources(highlightsQuery, injectionQuery, localsQuery)
+	querySource := slices.Concat(injectionQuery, localsQuery, highlightsQuery)
+	query := cfg.Query
+	names := query.CaptureNames()
+
+	var warnings []QueryWarning
+	for i := range cfg.LocalsPatternIndex {
+		content := cfg.InjectionContentCaptureIndex
+		if content == nil || query.CaptureQuantifiers(i)[*content] == tree_sitter.CaptureQuantifierZero {
+			warnings = append(warnings, sources.warning(query.StartByteForPattern(i), "injection pattern has no @injection.content capture, so it never injects anything"))
+		}
+	}
+
+	// overriddenBy holds the later pattern that overrides a pattern, if there is one.
+	overriddenBy := map[uint]uint{}
+	later := map[string]uint{}
+	for i := query.PatternCount(); i > cfg.HighlightsPatternIndex; i-- {
+		pattern := i - 1
+		text := string(querySource[query.StartByteForPattern(pattern):query.EndByteForPattern(pattern)])
+		text = queryComment.ReplaceAllString(text, "")
+		text = captureName.ReplaceAllString(text, "@")
+		text = strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+
+		if j, ok := later[text]; ok {
+			overriddenBy[pattern] = j
+		}
+		// Patterns with predicates don't always apply, so they don't override others.
+		if !strings.Contains(text, "(#") {
+			later[text] = pattern
+		}
+	}
+
+	reported := map[string]bool{}
+	for i := cfg.HighlightsPatternIndex; i < query.PatternCount(); i++ {
+		offset := query.StartByteForPattern(i)
+		if j, ok := overriddenBy[i]; ok {
+			file, fileOffset := sources.locate(query.StartByteForPattern(j))
+			line, _, _ := position(file.source, fileOffset)
+			warnings = append(warnings, sources.warning(offset, "pattern is overridden by an identical later pattern at line %d", line))
+		}
+
+		for c, quantifier := range query.CaptureQuantifiers(i) {
+			name := names[c]
+			if quantifier == tree_sitter.CaptureQuantifierZero || cfg.HighlightIndices[c] != nil || strings.HasPrefix(name, "_") || reported[name] {
+				continue
+			}
+			reported[name] = true
+			warnings = append(warnings, sources.warning(offset, "capture @%s matches no recognised name, so it is never highlighted", name))
+		}
+	}
+
+	return warnings, nil
+}
@@ -0,0 +1,146 @@
+package config_test
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/config"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+func TestNewQueryError(t *testing.T) {
+	tests := []struct {
+		name       string
+		highlights string
+		injections string
+		locals     string
+		want       config.QueryError
+	}{
+		{
+			name:       "highlights",
+			highlights: "(identifier) @variable\n\n  (not_a_node) @constant\n",
+			injections: "(comment) @injection.content\n",
+			locals:     "(identifier) @local.reference\n",
+			want:       config.QueryError{File: "highlights", Line: 3, Column: 4, Kind: tree_sitter.QueryErrorNodeType, Message: "not_a_node", Snippet: "  (not_a_node) @constant"},
+		},
+		{
+			name:       "injections",
+			highlights: "(identifier) @variable\n",
+			injections: "(comment) @injection.content\n(call not_a_field: (_) @injection.content)\n",
+			want:       config.QueryError{File: "injections", Line: 2, Column: 7, Kind: tree_sitter.QueryErrorField, Message: "not_a_field", Snippet: "(call not_a_field: (_) @injection.content)"},
+		},
+		{
+			name:       "locals",
+			highlights: "(identifier) @variable\n",
+			injections: "(comment) @injection.content\n",
+			locals:     "(function_definition) @local.scope\n(identifier) @local.reference)\n",
+			want:       config.QueryError{File: "locals", Line: 2, Column: 30, Kind: tree_sitter.QueryErrorSyntax, Snippet: "(identifier) @local.reference)"},
+		},
+		{
+			name:       "predicate",
+			highlights: "(identifier) @variable\n(string) @string\n((identifier) @constant\n (#eq? @constant))\n",
+			injections: "(comment) @injection.content\n",
+			locals:     "(identifier) @local.reference\n",
+			want:       config.QueryError{File: "highlights", Line: 3, Column: 1, Kind: tree_sitter.QueryErrorPredicate, Snippet: "((identifier) @constant"},
+		},
+	}
+
+	language := testlang.Language("python").Lang
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.New(language, "python", []byte(tt.highlights), []byte(tt.injections), []byte(tt.locals), testlang.Names)
+			var queryErr *config.QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("got error %v, want a query error", err)
+			}
+			got := *queryErr
+
+			// The offset is in the query with the error, like the line and column.
+			source := map[string]string{"highlights": tt.highlights, "injections": tt.injections, "locals": tt.locals}[got.File]
+			lineStart := len(strings.Join(strings.SplitAfter(source, "\n")[:got.Line-1], ""))
+			if want := uint(lineStart + got.Column - 1); got.Offset != want {
+				t.Errorf("got offset %d, want %d for line %d, column %d", got.Offset, want, got.Line, got.Column)
+			}
+			got.Offset = 0
+			if tt.want.Message == "" {
+				got.Message = ""
+			}
+			if got != tt.want {
+				t.Errorf("got error %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		highlights string
+		injections string
+		want       []string
+	}{
+		{
+			name:       "overridden pattern",
+			highlights: "(identifier) @variable\n(string) @string\n(identifier) @constant\n",
+			want:       []string{"highlights:1:1: pattern is overridden by an identical later pattern at line 3"},
+		},
+		{
+			name:       "overridden pattern with other comments and whitespace",
+			highlights: "(call\n  function: (identifier) @function) ; a call\n(call function: (identifier)  @variable)\n",
+			want:       []string{"highlights:1:1: pattern is overridden by an identical later pattern at line 3"},
+		},
+		{
+			name:       "not overridden because of a predicate",
+			highlights: "(identifier) @variable\n((identifier) @constant\n (#match? @constant \"^[A-Z]\"))\n",
+			want:       nil,
+		},
+		{
+			name:       "not overridden by an earlier pattern",
+			highlights: "(identifier) @variable\n(call function: (identifier) @function)\n",
+			want:       nil,
+		},
+		{
+			// The later pattern overrides the earlier one for every node it
+			// matches, but isn't identical to it.
+			name:       "not identical to a later pattern",
+			highlights: "(call function: (identifier) @function)\n(identifier) @variable\n",
+			want:       nil,
+		},
+		{
+			name:       "unrecognised capture names",
+			highlights: "(identifier) @not.recognised\n((string) @_string @string (#eq? @_string \"x\"))\n(integer) @not.recognised\n",
+			want:       []string{"highlights:1:1: capture @not.recognised matches no recognised name, so it is never highlighted"},
+		},
+		{
+			name:       "located in the highlights query after the other queries",
+			injections: "(comment) @injection.content\n\n(string) @_string\n",
+			highlights: "\n(identifier) @variable\n(identifier) @constant\n",
+			want: []string{
+				"injections:3:1: injection pattern has no @injection.content capture, so it never injects anything",
+				"highlights:2:1: pattern is overridden by an identical later pattern at line 3",
+			},
+		},
+	}
+
+	language := testlang.Language("python").Lang
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := config.Validate(language, "python", []byte(tt.highlights), []byte(tt.injections), []byte("(identifier) @local.reference\n"), testlang.Names)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, warning := range warnings {
+				got = append(got, warning.File+":"+strconv.Itoa(warning.Line)+":"+strconv.Itoa(warning.Column)+": "+warning.Message)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got warnings %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package events
 
-import "github.com/noclaps/go-tree-sitter-highlight/types"
+import (
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
 
 // Event is an interface that represents a highlight Event.
 // Possible implementations are:
@@ -29,7 +32,9 @@ type EventLayerStart struct {
 
 func (EventLayerStart) highlightEvent() {}
 
-// EventLayerEnd is emitted when a language injection ends.
+// EventLayerEnd is emitted when a language injection ends, before the
+// [EventLayerStart] of the next layer. Layers don't nest, and captures stay
+// open across layer switches.
 type EventLayerEnd struct{}
 
 func (EventLayerEnd) highlightEvent() {}
@@ -38,6 +43,14 @@ func (EventLayerEnd) highlightEvent() {}
 type EventCaptureStart struct {
 	// Highlight is the capture name of the highlight.
 	Highlight types.CaptureIndex
+	// Name is the full name of the capture in the highlights query.
+	Name string
+	// Kind is the kind of the captured node.
+	Kind string
+	// Range is the range of the captured node in the source.
+	Range tree_sitter.Range
+	// Depth is the depth of the layer of the capture.
+	Depth uint
 }
 
 func (EventCaptureStart) highlightEvent() {}
@@ -7,13 +7,47 @@ import (
 
 const DefaultHighlight = types.CaptureIndex(^uint(0))
 
+// TreeCache provides syntax trees that have already been parsed for the source being highlighted.
+type TreeCache interface {
+	// Tree returns the tree for the layer with the given language and ranges, or nil if there is none.
+	// The returned tree stays owned by the cache.
+	Tree(languageName string, ranges []tree_sitter.Range) *tree_sitter.Tree
+}
+
+// Window is the part of the source, in bytes, that is highlighted.
+type Window struct {
+	StartByte uint
+	EndByte   uint
+}
+
 // Highlighter is a syntax Highlighter that uses tree-sitter to parse source code and apply syntax highlighting. It is not thread-safe.
 type Highlighter struct {
-	Parser  *tree_sitter.Parser
+	Parser *tree_sitter.Parser
+	// Trees is consulted before parsing a layer, if set.
+	Trees TreeCache
+	// Window restricts the captures of all layers to a part of the source, if set.
+	Window  *Window
 	cursors []*tree_sitter.QueryCursor
 }
 
+// NewHighlighter creates a Highlighter with a new parser.
+func NewHighlighter() *Highlighter {
+	return &Highlighter{
+		Parser: tree_sitter.NewParser(),
+	}
+}
+
+// Close frees the parser and all pooled cursors. The Highlighter must not be used afterwards.
+func (h *Highlighter) Close() {
+	for _, cursor := range h.cursors {
+		cursor.Close()
+	}
+	h.cursors = nil
+	h.Parser.Close()
+}
+
 func (h *Highlighter) PushCursor(cursor *tree_sitter.QueryCursor) {
+	cursor.SetByteRange(0, ^uint(0))
 	h.cursors = append(h.cursors, cursor)
 }
 
@@ -27,6 +61,13 @@ func (h *Highlighter) PopCursor() *tree_sitter.QueryCursor {
 	return cursor
 }
 
+// RestrictCursor limits the captures of the cursor to the Window, if there is one.
+func (h *Highlighter) RestrictCursor(cursor *tree_sitter.QueryCursor) {
+	if h.Window != nil {
+		cursor.SetByteRange(h.Window.StartByte, h.Window.EndByte)
+	}
+}
+
 // Compute the ranges that should be included when parsing an injection.
 // This takes into account three things:
 //   - `parent_ranges` - The ranges must all fall within the *current* layer's ranges.
@@ -121,27 +162,57 @@ func IntersectRanges(parentRanges []tree_sitter.Range, nodes []tree_sitter.Node,
 	return result
 }
 
-func InjectionForMatch(config types.Configuration, parentName string, query *tree_sitter.Query, match tree_sitter.QueryMatch, source []byte) (string, *tree_sitter.Node, bool) {
-	if config.InjectionContentCaptureIndex == nil || config.InjectionLanguageCaptureIndex == nil {
-		return "", nil, false
+// InjectionRanges computes the ranges of the content of an injection from its content node, narrowed
+// to contentRange if a directive changed the range of the content capture.
+func InjectionRanges(parentRanges []tree_sitter.Range, contentNode tree_sitter.Node, includesChildren bool, contentRange *tree_sitter.Range) []tree_sitter.Range {
+	ranges := IntersectRanges(parentRanges, []tree_sitter.Node{contentNode}, includesChildren)
+	if contentRange != nil {
+		ranges = NarrowRanges(ranges, *contentRange)
+	}
+	return ranges
+}
+
+// InjectionForMatch returns the language name, content node and whether to include the children
+// of an injection match, after running the custom directives of its pattern. The content range is
+// set if a directive changed the range of the content capture. If the language isn't captured or
+// set, the configuration's [types.InjectionDetector] is asked for it.
+func InjectionForMatch(config types.Configuration, parentName string, query *tree_sitter.Query, match tree_sitter.QueryMatch, source []byte) (string, *tree_sitter.Node, bool, *tree_sitter.Range) {
+	if config.InjectionContentCaptureIndex == nil {
+		return "", nil, false, nil
 	}
 
 	var (
 		languageName    string
 		contentNode     *tree_sitter.Node
+		contentRange    *tree_sitter.Range
 		includeChildren bool
 	)
 
+	metadata := ApplyDirectives(config, query, &match, source)
 	for _, capture := range match.Captures {
 		index := uint(capture.Index)
-		switch index {
-		case *config.InjectionLanguageCaptureIndex:
-			languageName = capture.Node.Utf8Text(source)
-		case *config.InjectionContentCaptureIndex:
+		switch {
+		case config.InjectionLanguageCaptureIndex != nil && index == *config.InjectionLanguageCaptureIndex:
+			if text, ok := metadata.Texts[index]; ok {
+				languageName = text
+			} else {
+				languageName = capture.Node.Utf8Text(source)
+			}
+		case index == *config.InjectionContentCaptureIndex:
 			contentNode = &capture.Node
+			if r, ok := metadata.Ranges[index]; ok {
+				contentRange = &r
+			}
 		}
 	}
 
+	if languageName == "" {
+		languageName = metadata.Properties[captureInjectionLanguage]
+	}
+	if _, ok := metadata.Properties[captureInjectionIncludeChildren]; ok {
+		includeChildren = true
+	}
+
 	for _, property := range query.PropertySettings(match.PatternIndex) {
 		switch property.Key {
 		case captureInjectionLanguage:
@@ -161,5 +232,14 @@ func InjectionForMatch(config types.Configuration, parentName string, query *tre
 		}
 	}
 
-	return languageName, contentNode, includeChildren
+	if languageName == "" && contentNode != nil && config.InjectionDetector != nil {
+		start, end := contentNode.StartByte(), contentNode.EndByte()
+		if contentRange != nil {
+			start, end = contentRange.StartByte, contentRange.EndByte
+		}
+		end = min(end, uint(len(source)))
+		languageName = config.InjectionDetector(source[min(start, end):end])
+	}
+
+	return languageName, contentNode, includeChildren, contentRange
 }
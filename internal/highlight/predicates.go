@@ -0,0 +1,86 @@
+package highlight
+
+import (
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// SatisfiesPredicates reports whether the match satisfies the custom predicates of its pattern
+// that are registered on the configuration. Predicates that aren't registered are ignored.
+func SatisfiesPredicates(config types.Configuration, query *tree_sitter.Query, match *tree_sitter.QueryMatch, source []byte) bool {
+	if len(config.Predicates) == 0 {
+		return true
+	}
+
+	for _, predicate := range query.GeneralPredicates(match.PatternIndex) {
+		if !strings.HasSuffix(predicate.Operator, "?") {
+			continue
+		}
+
+		fn, negate := config.Predicates[predicate.Operator], false
+		if fn == nil {
+			if name, ok := strings.CutPrefix(predicate.Operator, "not-"); ok {
+				fn, negate = config.Predicates[name], true
+			}
+		}
+		if fn == nil {
+			continue
+		}
+
+		call := types.PredicateCall{
+			Operator: predicate.Operator,
+			Args:     predicate.Args,
+			Match:    match,
+			Source:   source,
+		}
+		if fn(call) == negate {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyDirectives runs the custom directives of the match's pattern that are registered on the
+// configuration, in order, and returns the metadata they set.
+func ApplyDirectives(config types.Configuration, query *tree_sitter.Query, match *tree_sitter.QueryMatch, source []byte) types.MatchMetadata {
+	var metadata types.MatchMetadata
+	if len(config.Directives) == 0 {
+		return metadata
+	}
+
+	for _, predicate := range query.GeneralPredicates(match.PatternIndex) {
+		fn := config.Directives[predicate.Operator]
+		if fn == nil {
+			continue
+		}
+
+		fn(types.PredicateCall{
+			Operator: predicate.Operator,
+			Args:     predicate.Args,
+			Match:    match,
+			Source:   source,
+		}, &metadata)
+	}
+	return metadata
+}
+
+// NarrowRanges limits ranges to the bytes of r, dropping the ranges outside of it.
+func NarrowRanges(ranges []tree_sitter.Range, r tree_sitter.Range) []tree_sitter.Range {
+	var result []tree_sitter.Range
+	for _, rng := range ranges {
+		if rng.StartByte < r.StartByte {
+			rng.StartByte = r.StartByte
+			rng.StartPoint = r.StartPoint
+		}
+		if rng.EndByte > r.EndByte {
+			rng.EndByte = r.EndByte
+			rng.EndPoint = r.EndPoint
+		}
+		if rng.StartByte < rng.EndByte {
+			result = append(result, rng)
+		}
+	}
+	return result
+}
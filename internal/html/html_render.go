@@ -1,106 +1,276 @@
 package html
 
 import (
+	"bufio"
 	"fmt"
-	"html"
+	"io"
 	"iter"
 	"slices"
+	"strings"
 
 	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
-	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/lines"
 	"github.com/noclaps/go-tree-sitter-highlight/types"
 )
 
-func addText(source string, hs []types.CaptureIndex, languages []string, callback types.AttributeCallback) string {
-	output := ""
+// span is a highlight element that is currently open in the output.
+type span struct {
+	// element is `span`, or `a` for links.
+	element    string
+	attributes string
+}
 
-	for _, c := range source {
-		if c == '\r' {
-			continue
-		}
+type renderer struct {
+	w            *bufio.Writer
+	err          error
+	callback     types.AttributeCallback
+	nodeCallback types.NodeAttributeCallback
+	lineEndings  types.LineEndings
+	layout       lines.Layout
+	classPrefix  string
+	spans        []span
+	languages    []string
+}
+
+func (r *renderer) writeString(s string) {
+	if r.err != nil {
+		return
+	}
+	_, r.err = r.w.WriteString(s)
+}
 
-		if c == '\n' {
-			for range len(hs) - 1 {
-				output += endHighlight()
+// addText writes the source from start to end.
+func (r *renderer) addText(source string, start int, end int) {
+	for i := start; i < end; i++ {
+		var escaped string
+		lineBreak := false
+		whitespace := false
+		switch source[i] {
+		case ' ', '\t':
+			if !r.layout.Active() {
+				continue
 			}
+			whitespace = true
+		case '\r':
+			escaped, lineBreak = lines.CarriageReturn(r.lineEndings, source, i)
+		case '\n':
+			escaped, lineBreak = "\n", true
+		case '&':
+			escaped = "&amp;"
+		case '\'':
+			escaped = "&#39;"
+		case '<':
+			escaped = "&lt;"
+		case '>':
+			escaped = "&gt;"
+		case '"':
+			escaped = "&#34;"
+		default:
+			continue
+		}
 
-			output += string(c)
+		r.writeText(source, start, i)
+		start = i + 1
 
-			nextLanguage, closeLanguage := iter.Pull(slices.Values(languages))
-			defer closeLanguage()
+		if whitespace {
+			r.addWhitespace(source, i)
+			continue
+		}
 
-			languageName, _ := nextLanguage()
-			for i, h := range hs {
-				if i == 0 {
-					continue
-				}
-				output += startHighlight(h, languageName, callback)
-				if h == highlight.DefaultHighlight {
-					languageName, _ = nextLanguage()
-				}
+		if lineBreak {
+			r.layout.LineBreak(i)
+			// Close and reopen all spans at line breaks, so that every line
+			// of the output is balanced on its own.
+			for _, s := range slices.Backward(r.spans) {
+				r.endHighlight(s)
+			}
+			r.writeString(escaped)
+			for _, s := range r.spans {
+				r.startHighlight(s)
 			}
-
 			continue
 		}
 
-		output += html.EscapeString(string(c))
+		if source[i] == '\r' {
+			r.layout.Replaced(source, i, escaped)
+		} else {
+			r.layout.Text(source, i, i+1)
+		}
+		r.writeString(escaped)
+	}
+	r.writeText(source, start, end)
+}
+
+// writeText writes text without line breaks or characters that need escaping.
+func (r *renderer) writeText(source string, start int, end int) {
+	r.layout.Text(source, start, end)
+	r.writeString(source[start:end])
+}
+
+// addWhitespace writes the tab or space at offset i, in an element with
+// classes for its kinds if it is marked.
+func (r *renderer) addWhitespace(source string, i int) {
+	text, kinds := r.layout.Whitespace(source, i)
+	if len(kinds) == 0 {
+		r.writeString(text)
+		return
 	}
 
-	return output
+	classes := []string{r.classPrefix + "whitespace"}
+	for _, kind := range kinds {
+		classes = append(classes, r.classPrefix+kind)
+	}
+	r.writeString(`<span class="`)
+	r.writeString(strings.Join(classes, " "))
+	r.writeString(`">`)
+	r.writeString(text)
+	r.writeString("</span>")
 }
 
-func startHighlight(h types.CaptureIndex, languageName string, callback types.AttributeCallback) string {
-	output := "<span"
+// attributeEscaper escapes attribute values. Line breaks are escaped too, so
+// every line of the output stays balanced.
+var attributeEscaper = strings.NewReplacer(`&`, "&amp;", `'`, "&#39;", `<`, "&lt;", `>`, "&gt;", `"`, "&#34;", "\n", "&#10;", "\r", "&#13;")
+
+// newSpan returns the element for a highlight, with the attributes from the callbacks.
+func (r *renderer) newSpan(e events.EventCaptureStart, languageName string, source string) span {
+	if r.nodeCallback == nil {
+		s := span{element: "span"}
+		if r.callback != nil {
+			s.attributes = r.callback(e.Highlight, languageName)
+		}
+		return s
+	}
+
+	var text string
+	if e.Range.StartByte <= e.Range.EndByte && e.Range.EndByte <= uint(len(source)) {
+		text = source[e.Range.StartByte:e.Range.EndByte]
+	}
+	nodeAttributes := r.nodeCallback(types.Capture{
+		Highlight:    e.Highlight,
+		Name:         e.Name,
+		LanguageName: languageName,
+		Depth:        e.Depth,
+		Kind:         e.Kind,
+		Range:        e.Range,
+		Text:         text,
+	})
 
-	var attributes string
-	if callback != nil {
-		attributes = callback(h, languageName)
+	s := span{element: "span"}
+	var attributes []string
+	if nodeAttributes.Href != "" {
+		s.element = "a"
+		attributes = append(attributes, fmt.Sprintf(`href="%s"`, attributeEscaper.Replace(nodeAttributes.Href)))
+	}
+	if nodeAttributes.Title != "" {
+		attributes = append(attributes, fmt.Sprintf(`title="%s"`, attributeEscaper.Replace(nodeAttributes.Title)))
+	}
+	if nodeAttributes.Attributes != "" {
+		attributes = append(attributes, nodeAttributes.Attributes)
 	}
+	s.attributes = strings.Join(attributes, " ")
+	return s
+}
+
+func (r *renderer) startHighlight(s span) {
+	r.writeString("<")
+	r.writeString(s.element)
 
-	if len(attributes) > 0 {
-		output += " " + string(attributes)
+	if len(s.attributes) > 0 {
+		r.writeString(" ")
+		r.writeString(s.attributes)
 	}
 
-	output += ">"
-	return output
+	r.writeString(">")
 }
 
-func endHighlight() string {
-	return "</span>"
+func (r *renderer) endHighlight(s span) {
+	r.writeString("</")
+	r.writeString(s.element)
+	r.writeString(">")
 }
 
-// render renders the code and returns it as a string, with spans for each highlight capture.
+// Render renders the code and returns it as a string, with spans for each highlight capture.
 // The [AttributeCallback] is used to generate the classes or inline styles for each span.
 func Render(highlightEvents iter.Seq2[events.Event, error], source string, callback types.AttributeCallback) (string, error) {
-	output := ""
+	var output strings.Builder
+	if err := RenderTo(&output, highlightEvents, source, callback); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// RenderTo is like [Render], but writes the output to w as the events arrive.
+// Writes are buffered, and the buffer is flushed before returning.
+func RenderTo(w io.Writer, highlightEvents iter.Seq2[events.Event, error], source string, callback types.AttributeCallback) error {
+	r := &renderer{
+		w:        bufio.NewWriter(w),
+		callback: callback,
+	}
+	return r.renderAll(highlightEvents, source)
+}
 
-	var (
-		highlights []types.CaptureIndex
-		languages  []string
-	)
+// renderAll renders all events and flushes the output.
+func (r *renderer) renderAll(highlightEvents iter.Seq2[events.Event, error], source string) error {
 	for event, err := range highlightEvents {
 		if err != nil {
-			return "", fmt.Errorf("error while rendering: %w", err)
+			r.w.Flush()
+			return fmt.Errorf("error while rendering: %w", err)
+		}
+
+		r.render(event, source)
+		if r.err != nil {
+			return fmt.Errorf("error while writing: %w", r.err)
+		}
+	}
+
+	if err := r.w.Flush(); err != nil {
+		return fmt.Errorf("error while writing: %w", err)
+	}
+	return nil
+}
+
+// RenderLines renders the code like [Render], but returns the HTML of each line separately.
+// Every line is balanced on its own, with the spans that are open at its start reopened,
+// and all spans closed at its end. Line breaks are not included.
+func RenderLines(highlightEvents iter.Seq2[events.Event, error], source string, callback types.AttributeCallback) ([]string, error) {
+	var output strings.Builder
+	r := &renderer{
+		w:        bufio.NewWriter(&output),
+		callback: callback,
+	}
+
+	var result []string
+	for line, err := range lines.Split(highlightEvents, source, r.lineEndings) {
+		if err != nil {
+			return nil, fmt.Errorf("error while rendering: %w", err)
 		}
 
-		switch e := event.(type) {
-		case events.EventLayerStart:
-			highlights = append(highlights, highlight.DefaultHighlight)
-			languages = append(languages, e.LanguageName)
-		case events.EventLayerEnd:
-			highlights = highlights[:len(highlights)-1]
-			languages = languages[:len(languages)-1]
-		case events.EventCaptureStart:
-			highlights = append(highlights, e.Highlight)
-			language := languages[len(languages)-1]
-			output += startHighlight(e.Highlight, language, callback)
-		case events.EventCaptureEnd:
-			highlights = highlights[:len(highlights)-1]
-			output += endHighlight()
-		case events.EventSource:
-			output += addText(source[e.StartByte:e.EndByte], highlights, languages, callback)
+		for _, event := range line {
+			r.render(event, source)
 		}
+		r.w.Flush()
+		result = append(result, output.String())
+		output.Reset()
 	}
 
-	return output, nil
+	return result, nil
+}
+
+func (r *renderer) render(event events.Event, source string) {
+	switch e := event.(type) {
+	case events.EventLayerStart:
+		r.languages = append(r.languages, e.LanguageName)
+	case events.EventLayerEnd:
+		r.languages = r.languages[:len(r.languages)-1]
+	case events.EventCaptureStart:
+		s := r.newSpan(e, r.languages[len(r.languages)-1], source)
+		r.spans = append(r.spans, s)
+		r.startHighlight(s)
+	case events.EventCaptureEnd:
+		s := r.spans[len(r.spans)-1]
+		r.spans = r.spans[:len(r.spans)-1]
+		r.endHighlight(s)
+	case events.EventSource:
+		r.addText(source, int(e.StartByte), int(e.EndByte))
+	}
 }
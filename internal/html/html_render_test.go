@@ -0,0 +1,177 @@
+package html
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// testNames are the names of the highlights in the events of the tests.
+var testNames = []string{"comment", "keyword", "string", "variable"}
+
+func layerStart(languageName string) events.Event {
+	return events.EventLayerStart{LanguageName: languageName}
+}
+
+// captureStart starts a highlight of one of testNames, for the node from start to end.
+func captureStart(name string, start uint, end uint) events.Event {
+	return events.EventCaptureStart{
+		Highlight: types.CaptureIndex(slices.Index(testNames, name)),
+		Name:      name,
+		Kind:      "node",
+		Range:     tree_sitter.Range{StartByte: start, EndByte: end},
+	}
+}
+
+func text(start uint, end uint) events.Event {
+	return events.EventSource{StartByte: start, EndByte: end}
+}
+
+var (
+	layerEnd   events.Event = events.EventLayerEnd{}
+	captureEnd events.Event = events.EventCaptureEnd{}
+)
+
+func seq(highlightEvents ...events.Event) iter.Seq2[events.Event, error] {
+	return func(yield func(events.Event, error) bool) {
+		for _, event := range highlightEvents {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// classCallback sets the language and the name of the highlight as classes.
+func classCallback(h types.CaptureIndex, languageName string) string {
+	return fmt.Sprintf(`class="%s %s"`, languageName, testNames[h])
+}
+
+// injectedSource has a string that spans two lines, with an injection in it,
+// and injectedEvents are its events like the highlighter emits them: the
+// string stays open while the injected layer is highlighted.
+const injectedSource = "x = `a\nb`\ny"
+
+var injectedEvents = []events.Event{
+	layerStart("js"), captureStart("variable", 0, 1), text(0, 1), captureEnd, text(1, 4), captureStart("string", 4, 9), text(4, 5),
+	layerEnd, layerStart("css"), captureStart("keyword", 5, 6), text(5, 6), captureEnd, text(6, 7), captureStart("keyword", 7, 8), text(7, 8), captureEnd,
+	layerEnd, layerStart("js"), text(8, 9), captureEnd, text(9, 10), captureStart("variable", 10, 11), text(10, 11), captureEnd,
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		events []events.Event
+		want   string
+	}{
+		{
+			name:   "captures",
+			source: "var x",
+			events: []events.Event{layerStart("js"), captureStart("keyword", 0, 3), text(0, 3), captureEnd, text(3, 4), captureStart("variable", 4, 5), text(4, 5), captureEnd},
+			want:   `<span class="js keyword">var</span> <span class="js variable">x</span>`,
+		},
+		{
+			name:   "escaping",
+			source: `a<b>&'"`,
+			events: []events.Event{layerStart("js"), captureStart("string", 0, 7), text(0, 7), captureEnd},
+			want:   `<span class="js string">a&lt;b&gt;&amp;&#39;&#34;</span>`,
+		},
+		{
+			name:   "nested captures across lines",
+			source: "/* a\nb */",
+			events: []events.Event{layerStart("js"), captureStart("comment", 0, 9), captureStart("keyword", 0, 6), text(0, 6), captureEnd, text(6, 9), captureEnd},
+			want:   "<span class=\"js comment\"><span class=\"js keyword\">/* a</span></span>\n<span class=\"js comment\"><span class=\"js keyword\">b</span> */</span>",
+		},
+		{
+			name:   "injection",
+			source: injectedSource,
+			events: injectedEvents,
+			want: "<span class=\"js variable\">x</span> = <span class=\"js string\">`<span class=\"css keyword\">a</span></span>\n" +
+				"<span class=\"js string\"><span class=\"css keyword\">b</span>`</span>\n<span class=\"js variable\">y</span>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(seq(tt.events...), tt.source, classCallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	errTest := errors.New("test error")
+	highlightEvents := func(yield func(events.Event, error) bool) {
+		_ = yield(layerStart("js"), nil) && yield(text(0, 1), nil) && yield(nil, errTest)
+	}
+	if _, err := Render(highlightEvents, "a", classCallback); !errors.Is(err, errTest) {
+		t.Errorf("got error %v, want %v", err, errTest)
+	}
+}
+
+func TestRenderLines(t *testing.T) {
+	got, err := RenderLines(seq(injectedEvents...), injectedSource, classCallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every line reopens the string of the outer layer, with the language of
+	// the layer it was started in.
+	want := []string{
+		"<span class=\"js variable\">x</span> = <span class=\"js string\">`<span class=\"css keyword\">a</span></span>",
+		"<span class=\"js string\"><span class=\"css keyword\">b</span>`</span>",
+		"<span class=\"js variable\">y</span>",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got lines\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRenderNodeAttributeCallback(t *testing.T) {
+	source := `import "fmt"`
+	highlightEvents := seq(layerStart("go"), captureStart("keyword", 0, 6), text(0, 6), captureEnd, text(6, 7), captureStart("string", 7, 12), text(7, 12), captureEnd)
+
+	var captures []types.Capture
+	var out bytes.Buffer
+	err := RenderWithOptions(&out, highlightEvents, source, classCallback, Options{
+		NodeAttributeCallback: func(capture types.Capture) types.NodeAttributes {
+			captures = append(captures, capture)
+			if capture.Name == "string" {
+				return types.NodeAttributes{
+					Attributes: `class="string"`,
+					Title:      `package "fmt"`,
+					Href:       "https://pkg.go.dev/fmt?a=1&b=2",
+				}
+			}
+			return types.NodeAttributes{Attributes: `class="keyword"`}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<span class="keyword">import</span> <a href="https://pkg.go.dev/fmt?a=1&amp;b=2" title="package &#34;fmt&#34;" class="string">&#34;fmt&#34;</a>`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	wantCaptures := []types.Capture{
+		{Highlight: 1, Name: "keyword", LanguageName: "go", Kind: "node", Range: tree_sitter.Range{StartByte: 0, EndByte: 6}, Text: "import"},
+		{Highlight: 2, Name: "string", LanguageName: "go", Kind: "node", Range: tree_sitter.Range{StartByte: 7, EndByte: 12}, Text: `"fmt"`},
+	}
+	if !slices.Equal(captures, wantCaptures) {
+		t.Errorf("got captures %+v, want %+v", captures, wantCaptures)
+	}
+}
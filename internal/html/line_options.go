@@ -0,0 +1,236 @@
+package html
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"iter"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/lines"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// LineNumbers is the way line numbers are shown.
+type LineNumbers int
+
+const (
+	// LineNumbersNone shows no line numbers.
+	LineNumbersNone LineNumbers = iota
+	// LineNumbersTable renders a table with a row per line, and the line
+	// numbers in the first column.
+	LineNumbersTable
+	// LineNumbersCSS renders an element per line, and shows the line numbers
+	// with a CSS counter. See [Options.CSS] for the stylesheet.
+	LineNumbersCSS
+)
+
+// LineRange is an inclusive range of 1-based line numbers.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// LineRanges is a set of line ranges.
+type LineRanges []LineRange
+
+// Contains reports whether the line is in any of the ranges.
+func (r LineRanges) Contains(line int) bool {
+	return slices.ContainsFunc(r, func(lineRange LineRange) bool {
+		return lineRange.Start <= line && line <= lineRange.End
+	})
+}
+
+// ParseLineRanges parses line ranges like `{3-5,9}` or `3-5,9`.
+func ParseLineRanges(s string) (LineRanges, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+
+	var result LineRanges
+	for part := range strings.SplitSeq(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(startStr))
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("invalid line range %q", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(strings.TrimSpace(endStr))
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid line range %q", part)
+			}
+		}
+		result = append(result, LineRange{Start: start, End: end})
+	}
+	return result, nil
+}
+
+// Options configures how lines are rendered by [RenderWithOptions].
+type Options struct {
+	// LineNumbers is the way line numbers are shown.
+	LineNumbers LineNumbers
+	// LineAnchors adds an `id` like `L42` to every line, so it can be linked to.
+	LineAnchors bool
+	// AnchorPrefix is the prefix of the line anchors. The default is `L`.
+	AnchorPrefix string
+	// StartLine is the number of the first line. The default is 1.
+	StartLine int
+	// HighlightLines are the lines that get the HighlightClass, numbered
+	// from StartLine.
+	HighlightLines LineRanges
+	// HighlightClass is the class of highlighted lines. The default is `highlighted`.
+	HighlightClass string
+	// ClassPrefix is added to all class names, e.g. `ts-` for `ts-line`.
+	ClassPrefix string
+	// LineEndings is how carriage returns are written.
+	LineEndings types.LineEndings
+	// Whitespace configures tab expansion and marking whitespace. Marked
+	// whitespace is put in an element with the class `whitespace`, and `tab`,
+	// `space` or `trailing`.
+	Whitespace types.Whitespace
+	// NodeAttributeCallback is used for the attributes of the highlights
+	// instead of the attribute callback, if it is set.
+	NodeAttributeCallback types.NodeAttributeCallback
+}
+
+func (o Options) withDefaults() Options {
+	if o.AnchorPrefix == "" {
+		o.AnchorPrefix = "L"
+	}
+	if o.StartLine == 0 {
+		o.StartLine = 1
+	}
+	if o.HighlightClass == "" {
+		o.HighlightClass = "highlighted"
+	}
+	return o
+}
+
+// wrapsLines reports whether lines need to be rendered in their own elements.
+func (o Options) wrapsLines() bool {
+	return o.LineNumbers != LineNumbersNone || o.LineAnchors || len(o.HighlightLines) > 0
+}
+
+// CSS returns the stylesheet needed for the line numbers, highlighted lines
+// and marked whitespace. Colors of the code are left to the page.
+func (o Options) CSS() string {
+	o = o.withDefaults()
+	p := o.ClassPrefix
+
+	var css strings.Builder
+	switch o.LineNumbers {
+	case LineNumbersTable:
+		fmt.Fprintf(&css, "table.%[1]slines { border-spacing: 0; }\n", p)
+		fmt.Fprintf(&css, ".%[1]sline-number { text-align: right; padding-right: 1em; user-select: none; vertical-align: top; }\n", p)
+		fmt.Fprintf(&css, ".%[1]sline-content { white-space: pre; }\n", p)
+	case LineNumbersCSS:
+		fmt.Fprintf(&css, ".%[1]slines { counter-reset: %[1]sline; }\n", p)
+		fmt.Fprintf(&css, ".%[1]sline { display: block; counter-increment: %[1]sline; }\n", p)
+		fmt.Fprintf(&css, ".%[1]sline::before { content: counter(%[1]sline); display: inline-block; width: 3em; margin-right: 1em; text-align: right; user-select: none; }\n", p)
+	default:
+		fmt.Fprintf(&css, ".%[1]sline { display: block; }\n", p)
+	}
+	fmt.Fprintf(&css, ".%s%s { background-color: rgba(255, 255, 0, 0.15); }\n", p, o.HighlightClass)
+	fmt.Fprintf(&css, ".%swhitespace { opacity: 0.5; }\n", p)
+	fmt.Fprintf(&css, ".%strailing { background-color: rgba(255, 0, 0, 0.2); }\n", p)
+	return css.String()
+}
+
+// lineAttributes returns the attributes of the element of a line.
+func (o Options) lineAttributes(number int) string {
+	classes := []string{o.ClassPrefix + "line"}
+	if o.HighlightLines.Contains(number) {
+		classes = append(classes, o.ClassPrefix+o.HighlightClass)
+	}
+
+	attributes := fmt.Sprintf(`class="%s" data-line="%d"`, strings.Join(classes, " "), number)
+	if o.LineAnchors {
+		attributes = fmt.Sprintf(`id="%s%d" `, o.AnchorPrefix, number) + attributes
+	}
+	if o.LineNumbers == LineNumbersCSS && number == o.StartLine && o.StartLine != 1 {
+		// Make the counter start at the first line number.
+		attributes += fmt.Sprintf(` style="counter-reset: %sline %d"`, o.ClassPrefix, o.StartLine-1)
+	}
+	return attributes
+}
+
+// RenderWithOptions renders the code like [RenderTo], with every line wrapped
+// in its own element if line numbers, line anchors or highlighted lines are
+// used. With [LineNumbersTable] the output is a `<table>` with a row per line,
+// otherwise it is a `<span>` per line, each ending with a line break. The
+// spans of the highlights are balanced within every line.
+func RenderWithOptions(w io.Writer, highlightEvents iter.Seq2[events.Event, error], source string, callback types.AttributeCallback, options Options) error {
+	bw := bufio.NewWriter(w)
+	r := &renderer{
+		w:            bw,
+		callback:     callback,
+		nodeCallback: options.NodeAttributeCallback,
+		lineEndings:  options.LineEndings,
+		layout:       lines.NewLayout(options.Whitespace),
+		classPrefix:  options.ClassPrefix,
+	}
+	if !options.wrapsLines() {
+		return r.renderAll(highlightEvents, source)
+	}
+	options = options.withDefaults()
+
+	table := options.LineNumbers == LineNumbersTable
+	if table {
+		r.writeString(fmt.Sprintf(`<table class="%slines"><tbody>`, options.ClassPrefix))
+		r.writeString("\n")
+	} else if options.LineNumbers == LineNumbersCSS {
+		r.writeString(fmt.Sprintf(`<span class="%slines">`, options.ClassPrefix))
+	}
+
+	number := options.StartLine
+	for line, err := range lines.Split(highlightEvents, source, options.LineEndings) {
+		if err != nil {
+			bw.Flush()
+			return fmt.Errorf("error while rendering: %w", err)
+		}
+
+		if table {
+			r.writeString(fmt.Sprintf(`<tr %s><td class="%sline-number">%d</td><td class="%sline-content">`, options.lineAttributes(number), options.ClassPrefix, number, options.ClassPrefix))
+		} else {
+			r.writeString(fmt.Sprintf(`<span %s>`, options.lineAttributes(number)))
+		}
+
+		for _, event := range line {
+			r.render(event, source)
+		}
+
+		if table {
+			r.writeString("</td></tr>\n")
+		} else {
+			// The line break is inside of the line's element, so a block
+			// element doesn't add an empty line in a `<pre>`.
+			r.writeString("\n</span>")
+		}
+		if r.err != nil {
+			return fmt.Errorf("error while writing: %w", r.err)
+		}
+		number++
+	}
+
+	if table {
+		r.writeString("</tbody></table>\n")
+	} else if options.LineNumbers == LineNumbersCSS {
+		r.writeString("</span>")
+	}
+
+	if r.err != nil {
+		return fmt.Errorf("error while writing: %w", r.err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("error while writing: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package html
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+func TestParseLineRanges(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    LineRanges
+		wantErr bool
+	}{
+		{s: "", want: nil},
+		{s: "3", want: LineRanges{{Start: 3, End: 3}}},
+		{s: "3-5,9", want: LineRanges{{Start: 3, End: 5}, {Start: 9, End: 9}}},
+		{s: "{3-5,9}", want: LineRanges{{Start: 3, End: 5}, {Start: 9, End: 9}}},
+		{s: " { 3 - 5 , 9 , } ", want: LineRanges{{Start: 3, End: 5}, {Start: 9, End: 9}}},
+		{s: "0", wantErr: true},
+		{s: "5-3", wantErr: true},
+		{s: "3-", wantErr: true},
+		{s: "a", wantErr: true},
+		{s: "1-2-3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLineRanges(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLineRanges(%q) returned error %v, want error %t", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ParseLineRanges(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestLineRangesContains(t *testing.T) {
+	ranges := LineRanges{{Start: 3, End: 5}, {Start: 9, End: 9}}
+	for line, want := range map[int]bool{1: false, 3: true, 4: true, 5: true, 6: false, 9: true, 10: false} {
+		if got := ranges.Contains(line); got != want {
+			t.Errorf("Contains(%d) = %t, want %t", line, got, want)
+		}
+	}
+}
+
+func TestOptionsCSS(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		want    []string
+	}{
+		{
+			name:    "table",
+			options: Options{LineNumbers: LineNumbersTable},
+			want:    []string{"table.lines {", ".line-number {", ".line-content {", ".highlighted {", ".whitespace {", ".trailing {"},
+		},
+		{
+			name:    "css",
+			options: Options{LineNumbers: LineNumbersCSS},
+			want:    []string{".lines { counter-reset: line; }", ".line { display: block; counter-increment: line; }", ".line::before { content: counter(line);"},
+		},
+		{
+			name:    "anchors",
+			options: Options{LineAnchors: true},
+			want:    []string{".line { display: block; }", ".highlighted {"},
+		},
+		{
+			name:    "prefix and highlight class",
+			options: Options{LineNumbers: LineNumbersCSS, ClassPrefix: "ts-", HighlightClass: "marked"},
+			want:    []string{".ts-lines { counter-reset: ts-line; }", ".ts-line::before { content: counter(ts-line);", ".ts-marked {", ".ts-whitespace {"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			css := tt.options.CSS()
+			for _, want := range tt.want {
+				if !strings.Contains(css, want) {
+					t.Errorf("CSS doesn't contain %q:\n%s", want, css)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderWithOptions(t *testing.T) {
+	source := "a\nb\nc"
+	sourceEvents := []events.Event{layerStart("js"), captureStart("variable", 0, 5), text(0, 5), captureEnd}
+
+	tests := []struct {
+		name    string
+		source  string
+		events  []events.Event
+		options Options
+		want    string
+	}{
+		{
+			name:    "no lines",
+			source:  source,
+			events:  sourceEvents,
+			options: Options{},
+			want:    "<span class=\"js variable\">a</span>\n<span class=\"js variable\">b</span>\n<span class=\"js variable\">c</span>",
+		},
+		{
+			name:    "table",
+			source:  source,
+			events:  sourceEvents,
+			options: Options{LineNumbers: LineNumbersTable},
+			want: "<table class=\"lines\"><tbody>\n" +
+				"<tr class=\"line\" data-line=\"1\"><td class=\"line-number\">1</td><td class=\"line-content\"><span class=\"js variable\">a</span></td></tr>\n" +
+				"<tr class=\"line\" data-line=\"2\"><td class=\"line-number\">2</td><td class=\"line-content\"><span class=\"js variable\">b</span></td></tr>\n" +
+				"<tr class=\"line\" data-line=\"3\"><td class=\"line-number\">3</td><td class=\"line-content\"><span class=\"js variable\">c</span></td></tr>\n" +
+				"</tbody></table>\n",
+		},
+		{
+			name:    "css",
+			source:  source,
+			events:  sourceEvents,
+			options: Options{LineNumbers: LineNumbersCSS, StartLine: 10, ClassPrefix: "ts-"},
+			want: "<span class=\"ts-lines\">" +
+				"<span class=\"ts-line\" data-line=\"10\" style=\"counter-reset: ts-line 9\"><span class=\"js variable\">a</span>\n</span>" +
+				"<span class=\"ts-line\" data-line=\"11\"><span class=\"js variable\">b</span>\n</span>" +
+				"<span class=\"ts-line\" data-line=\"12\"><span class=\"js variable\">c</span>\n</span>" +
+				"</span>",
+		},
+		{
+			name:    "anchors and highlighted lines",
+			source:  source,
+			events:  sourceEvents,
+			options: Options{LineAnchors: true, AnchorPrefix: "line-", HighlightLines: LineRanges{{Start: 2, End: 3}}, HighlightClass: "hl"},
+			want: "<span id=\"line-1\" class=\"line\" data-line=\"1\"><span class=\"js variable\">a</span>\n</span>" +
+				"<span id=\"line-2\" class=\"line hl\" data-line=\"2\"><span class=\"js variable\">b</span>\n</span>" +
+				"<span id=\"line-3\" class=\"line hl\" data-line=\"3\"><span class=\"js variable\">c</span>\n</span>",
+		},
+		{
+			name:    "injection",
+			source:  injectedSource,
+			events:  injectedEvents,
+			options: Options{LineAnchors: true},
+			want: "<span id=\"L1\" class=\"line\" data-line=\"1\"><span class=\"js variable\">x</span> = <span class=\"js string\">`<span class=\"css keyword\">a</span></span>\n</span>" +
+				"<span id=\"L2\" class=\"line\" data-line=\"2\"><span class=\"js string\"><span class=\"css keyword\">b</span>`</span>\n</span>" +
+				"<span id=\"L3\" class=\"line\" data-line=\"3\"><span class=\"js variable\">y</span>\n</span>",
+		},
+		{
+			name:    "carriage returns",
+			source:  "a\rb",
+			events:  []events.Event{layerStart("js"), text(0, 3)},
+			options: Options{LineNumbers: LineNumbersCSS, LineEndings: types.LineEndingsVisible},
+			want:    "<span class=\"lines\"><span class=\"line\" data-line=\"1\">a␍b\n</span></span>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := RenderWithOptions(&out, seq(tt.events...), tt.source, classCallback, tt.options); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderWithOptionsWhitespace(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		whitespace types.Whitespace
+		// events are the events of the source, or a single source event if they are nil.
+		events []events.Event
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			source: "\ta b \n",
+			want:   "\ta b \n",
+		},
+		{
+			name:       "tab width",
+			source:     "\ta\tb\n日\tc\n",
+			whitespace: types.Whitespace{TabWidth: 4},
+			want:       "    a   b\n日   c\n",
+		},
+		{
+			name:       "tabs",
+			source:     "\ta b",
+			whitespace: types.Whitespace{Tabs: true},
+			want:       `<span class="whitespace tab">` + "\t" + `</span>a b`,
+		},
+		{
+			name:       "spaces with glyphs",
+			source:     "\ta b",
+			whitespace: types.Whitespace{Spaces: true, Glyphs: true},
+			want:       "\ta" + `<span class="whitespace space">·</span>b`,
+		},
+		{
+			name:       "trailing",
+			source:     "a \t\nb \r\nc ",
+			whitespace: types.Whitespace{Trailing: true, TabWidth: 4, Glyphs: true},
+			want: "a" + `<span class="whitespace space trailing">·</span><span class="whitespace tab trailing">→ </span>` + "\nb" +
+				`<span class="whitespace space trailing">·</span>` + "\nc" + `<span class="whitespace space trailing">·</span>`,
+		},
+		{
+			name:       "tab after a capture",
+			source:     "ab\tc",
+			whitespace: types.Whitespace{TabWidth: 4},
+			events:     []events.Event{layerStart("js"), captureStart("variable", 0, 2), text(0, 2), captureEnd, text(2, 4)},
+			want:       `<span class="js variable">ab</span>  c`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			highlightEvents := tt.events
+			if highlightEvents == nil {
+				highlightEvents = []events.Event{layerStart("js"), text(0, uint(len(tt.source)))}
+			}
+
+			var out bytes.Buffer
+			if err := RenderWithOptions(&out, seq(highlightEvents...), tt.source, classCallback, Options{Whitespace: tt.whitespace}); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -17,10 +17,12 @@ type highlightRange struct {
 }
 
 type Iterator struct {
-	Ctx                context.Context
-	Source             []byte
-	LanguageName       string
-	ByteOffset         uint
+	Ctx          context.Context
+	Source       []byte
+	LanguageName string
+	ByteOffset   uint
+	// EndByte is where the output ends. Source after it is never emitted.
+	EndByte            uint
 	Highlighter        *highlight.Highlighter
 	InjectionCallback  types.InjectionCallback
 	Layers             []*iterLayer
@@ -31,6 +33,7 @@ type Iterator struct {
 
 func (h *Iterator) emitEvents(offset uint, events ...ts_events.Event) (ts_events.Event, error) {
 	var result ts_events.Event
+	offset = min(offset, h.EndByte)
 	if h.ByteOffset < offset {
 		result = ts_events.EventSource{
 			StartByte: h.ByteOffset,
@@ -66,12 +69,12 @@ main:
 
 		// If none of the layers have any more highlight boundaries, terminate.
 		if len(h.Layers) == 0 {
-			if h.ByteOffset < uint(len(h.Source)) {
+			if h.ByteOffset < h.EndByte {
 				event := ts_events.EventSource{
 					StartByte: h.ByteOffset,
-					EndByte:   uint(len(h.Source)),
+					EndByte:   h.EndByte,
 				}
-				h.ByteOffset = uint(len(h.Source))
+				h.ByteOffset = h.EndByte
 				return event, nil
 			}
 
@@ -115,7 +118,7 @@ main:
 				layer.HighlightEndStack = layer.HighlightEndStack[:len(layer.HighlightEndStack)-1]
 				return h.emitEvents(endByte, ts_events.EventCaptureEnd{})
 			}
-			return h.emitEvents(uint(len(h.Source)), nil)
+			return h.emitEvents(h.EndByte, nil)
 		}
 
 		match, captureIndex, _ := layer.Captures.Next()
@@ -123,7 +126,7 @@ main:
 
 		// If this capture represents an injection, then process the injection.
 		if match.PatternIndex < layer.Config.LocalsPatternIndex {
-			languageName, contentNode, includeChildren := highlight.InjectionForMatch(layer.Config, h.LanguageName, layer.Config.Query, match, h.Source)
+			languageName, contentNode, includeChildren, contentRange := highlight.InjectionForMatch(layer.Config, h.LanguageName, layer.Config.Query, match, h.Source)
 
 			// Explicitly remove this match so that none of its other captures will remain
 			// in the stream of captures.
@@ -134,9 +137,9 @@ main:
 			if languageName != "" && contentNode != nil {
 				newConfig := h.InjectionCallback(languageName)
 				if newConfig != nil {
-					ranges := highlight.IntersectRanges(layer.Ranges, []tree_sitter.Node{*contentNode}, includeChildren)
+					ranges := highlight.InjectionRanges(layer.Ranges, *contentNode, includeChildren, contentRange)
 					if len(ranges) > 0 {
-						newLayers, err := NewIterLayers(h.Source, h.LanguageName, h.Highlighter, h.InjectionCallback, *newConfig, layer.Depth+1, ranges)
+						newLayers, err := NewIterLayers(h.Ctx, h.Source, h.LanguageName, h.Highlighter, h.InjectionCallback, *newConfig, layer.Depth+1, ranges)
 						if err != nil {
 							return nil, err
 						}
@@ -159,12 +162,14 @@ main:
 		// If this capture is for tracking local variables, then process the
 		// local variable info.
 		var referenceHighlight *types.CaptureIndex
-		var definitionHighlight *types.CaptureIndex
+		// definition is the local definition for the current node, if it is one. Its
+		// highlight is set once the highlight for the node is known.
+		var definition *localDef
 		for match.PatternIndex < layer.Config.HighlightsPatternIndex {
 			// If the node represents a local scope, push a new local scope onto
 			// the scope stack.
 			if layer.Config.LocalScopeCaptureIndex != nil && uint(capture.Index) == *layer.Config.LocalScopeCaptureIndex {
-				definitionHighlight = nil
+				definition = nil
 				scope := localScope{
 					Inherits:  true,
 					Range:     nextCaptureRange,
@@ -172,7 +177,7 @@ main:
 				}
 				for _, prop := range layer.Config.Query.PropertySettings(match.PatternIndex) {
 					if prop.Key == highlight.CaptureLocalScopeInherits {
-						scope.Inherits = *prop.Value == "true"
+						scope.Inherits = prop.Value == nil || *prop.Value == "true"
 					}
 				}
 				layer.ScopeStack = append(layer.ScopeStack, scope)
@@ -180,8 +185,8 @@ main:
 				// If the node represents a definition, add a new definition to the
 				// local scope at the top of the scope stack.
 				referenceHighlight = nil
-				definitionHighlight = nil
-				scope := layer.ScopeStack[len(layer.ScopeStack)-1]
+				definition = nil
+				scope := &layer.ScopeStack[len(layer.ScopeStack)-1]
 
 				var valueRange tree_sitter.Range
 				for _, matchCapture := range match.Captures {
@@ -190,33 +195,31 @@ main:
 					}
 				}
 
-				if len(h.Source) > int(nextCaptureRange.StartByte) && len(h.Source) > int(valueRange.EndByte) {
+				if nextCaptureRange.EndByte <= uint(len(h.Source)) {
 					name := string(h.Source[nextCaptureRange.StartByte:nextCaptureRange.EndByte])
 
 					scope.LocalDefs = append(scope.LocalDefs, localDef{
-						Name:      name,
-						Range:     nextCaptureRange,
-						Highlight: nil,
+						Name:       name,
+						ValueRange: valueRange,
+						Highlight:  nil,
 					})
-					definitionHighlight = scope.LocalDefs[len(scope.LocalDefs)-1].Highlight
+					definition = &scope.LocalDefs[len(scope.LocalDefs)-1]
 				}
-			} else if layer.Config.LocalRefCaptureIndex != nil && uint(capture.Index) == *layer.Config.LocalRefCaptureIndex && definitionHighlight == nil {
+			} else if layer.Config.LocalRefCaptureIndex != nil && uint(capture.Index) == *layer.Config.LocalRefCaptureIndex && definition == nil {
 				// If the node represents a reference, then try to find the corresponding
 				// definition in the scope stack.
-				definitionHighlight = nil
-				if len(h.Source) > int(nextCaptureRange.StartByte) && len(h.Source) > int(nextCaptureRange.EndByte) {
+				if nextCaptureRange.EndByte <= uint(len(h.Source)) {
 					name := string(h.Source[nextCaptureRange.StartByte:nextCaptureRange.EndByte])
+				scopes:
 					for _, scope := range slices.Backward(layer.ScopeStack) {
-						var highlight *types.CaptureIndex
 						for _, def := range slices.Backward(scope.LocalDefs) {
-							if def.Name == name && nextCaptureRange.StartByte >= def.Range.EndByte {
-								highlight = def.Highlight
+							// A definition is only visible after its value, so that e.g.
+							// `let x = x + 1` refers to an outer `x` on the right side.
+							if def.Name == name && nextCaptureRange.StartByte >= def.ValueRange.EndByte {
+								referenceHighlight = def.Highlight
+								break scopes
 							}
 						}
-						if highlight != nil {
-							referenceHighlight = highlight
-							break
-						}
 						if !scope.Inherits {
 							break
 						}
@@ -249,6 +252,27 @@ main:
 			}
 		}
 
+		// If the current node was found to be a local variable, then ignore
+		// the following match if it's a highlighting pattern that is disabled
+		// for local variables.
+		isLocal := definition != nil || referenceHighlight != nil
+		if isLocal {
+			for layer.Config.NonLocalVariablePatterns[match.PatternIndex] {
+				match.Remove()
+				if nextMatch, nextCaptureIndex, ok := layer.Captures.peek(); ok {
+					nextCapture := nextMatch.Captures[nextCaptureIndex]
+					if nextCapture.Node.Equals(capture.Node) {
+						capture = nextCapture
+						match, _, _ = layer.Captures.Next()
+						continue
+					}
+				}
+
+				h.SortLayers()
+				continue main
+			}
+		}
+
 		// Once a highlighting pattern is found for the current node, keep iterating over
 		// any later highlighting patterns that also match this node and set the match to it.
 		// Captures for a given node are ordered by pattern index, so these subsequent
@@ -266,7 +290,7 @@ main:
 				// If the current node was found to be a local variable, then ignore
 				// the following match if it's a highlighting pattern that is disabled
 				// for local variables.
-				if definitionHighlight != nil || referenceHighlight != nil && layer.Config.NonLocalVariablePatterns[followingMatch.PatternIndex] {
+				if isLocal && layer.Config.NonLocalVariablePatterns[followingMatch.PatternIndex] {
 					continue
 				}
 
@@ -282,8 +306,8 @@ main:
 
 		// If this node represents a local definition, then store the current
 		// highlight value on the local scope entry representing this node.
-		if definitionHighlight != nil {
-			definitionHighlight = currentHighlight
+		if definition != nil {
+			definition.Highlight = currentHighlight
 		}
 
 		// Emit a scope start event and push the node's end position to the stack.
@@ -291,7 +315,9 @@ main:
 		if highlight == nil {
 			highlight = currentHighlight
 		}
-		if highlight != nil {
+		// Captures that start at the end of a window of the source have no text in it.
+		inWindow := nextCaptureRange.StartByte < h.EndByte || h.EndByte == uint(len(h.Source))
+		if highlight != nil && inWindow {
 			h.LastHighlightRange = &highlightRange{
 				start: nextCaptureRange.StartByte,
 				end:   nextCaptureRange.EndByte,
@@ -300,6 +326,10 @@ main:
 			layer.HighlightEndStack = append(layer.HighlightEndStack, nextCaptureRange.EndByte)
 			return h.emitEvents(nextCaptureRange.StartByte, ts_events.EventCaptureStart{
 				Highlight: *highlight,
+				Name:      layer.Config.Query.CaptureNames()[capture.Index],
+				Kind:      capture.Node.Kind(),
+				Range:     nextCaptureRange,
+				Depth:     layer.Depth,
 			})
 		}
 
@@ -315,7 +345,7 @@ func (h *Iterator) SortLayers() {
 			for i+1 < len(h.Layers) {
 				nextOffsetKey := h.Layers[i+1].sortKey()
 				if nextOffsetKey != nil {
-					if nextOffsetKey.greaterThan(*key) {
+					if nextOffsetKey.lessThan(*key) {
 						i += 1
 						continue
 					}
@@ -323,16 +353,26 @@ func (h *Iterator) SortLayers() {
 				break
 			}
 			if i > 0 {
-				h.Layers = append(rotateLeft(h.Layers[:i+1], 1), h.Layers[i+1:]...)
+				// Move the first layer behind the i layers that come before it.
+				layer := h.Layers[0]
+				copy(h.Layers[:i], h.Layers[1:i+1])
+				h.Layers[i] = layer
 			}
 			break
 		}
 		layer := h.Layers[0]
 		h.Layers = h.Layers[1:]
-		h.Highlighter.PushCursor(layer.Cursor)
+		layer.close(h.Highlighter)
 	}
 }
 
+// Close releases the syntax trees and cursors of all layers that have not been
+// fully processed yet. It must be called when iteration stops early.
+func (h *Iterator) Close() {
+	closeLayers(h.Layers, h.Highlighter)
+	h.Layers = nil
+}
+
 func (h *Iterator) insertLayer(layer *iterLayer) {
 	key := layer.sortKey()
 	if key != nil {
@@ -340,19 +380,18 @@ func (h *Iterator) insertLayer(layer *iterLayer) {
 		for i < len(h.Layers) {
 			keyI := h.Layers[i].sortKey()
 			if keyI != nil {
-				if keyI.lessThan(*key) {
+				if keyI.greaterThan(*key) {
 					h.Layers = slices.Insert(h.Layers, i, layer)
 					return
 				}
 				i += 1
 			} else {
+				h.Layers[i].close(h.Highlighter)
 				h.Layers = slices.Delete(h.Layers, i, i+1)
 			}
 		}
 		h.Layers = append(h.Layers, layer)
+	} else {
+		layer.close(h.Highlighter)
 	}
 }
-
-func rotateLeft[T any](s []T, i int) []T {
-	return append(s[i:], s[:i]...)
-}
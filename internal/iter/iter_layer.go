@@ -1,7 +1,7 @@
 package iter
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
 	"github.com/noclaps/go-tree-sitter-highlight/types"
@@ -15,9 +15,8 @@ type highlightQueueItem struct {
 }
 
 type injectionItem struct {
-	languageName    string
-	nodes           []tree_sitter.Node
-	includeChildren bool
+	languageName string
+	ranges       []tree_sitter.Range
 }
 
 type sortKey struct {
@@ -73,9 +72,11 @@ type _queryCapture struct {
 }
 
 type localDef struct {
-	Name      string
-	Range     tree_sitter.Range
-	Highlight *types.CaptureIndex
+	Name string
+	// ValueRange is the range of the definition's value, if it has one. References
+	// inside of it don't refer to this definition.
+	ValueRange tree_sitter.Range
+	Highlight  *types.CaptureIndex
 }
 
 type localScope struct {
@@ -85,6 +86,7 @@ type localScope struct {
 }
 
 func NewIterLayers(
+	ctx context.Context,
 	source []byte,
 	parentName string,
 	highlighter *highlight.Highlighter,
@@ -97,80 +99,49 @@ func NewIterLayers(
 	var queue []highlightQueueItem
 	for {
 		if err := highlighter.Parser.SetIncludedRanges(ranges); err == nil {
-			if err = highlighter.Parser.SetLanguage(config.Language); err != nil {
-				return nil, fmt.Errorf("error setting language: %w", err)
+			tree, ownsTree, err := parseLayer(ctx, highlighter, source, config, ranges, nil)
+			if err != nil {
+				closeLayers(result, highlighter)
+				return nil, err
 			}
-			tree := highlighter.Parser.ParseWithOptions(func(i int, p tree_sitter.Point) []byte {
-				return source[i:]
-			}, nil, nil)
 
 			cursor := highlighter.PopCursor()
 
 			// Process combined injections.
-			if config.CombinedInjectionsQuery != nil {
-				injectionsByPatternIndex := make([]injectionItem, config.CombinedInjectionsQuery.PatternCount())
-
-				matches := cursor.Matches(config.CombinedInjectionsQuery, tree.RootNode(), source)
-				for {
-					match := matches.Next()
-					if match == nil {
-						break
-					}
-
-					languageName, contentNode, includeChildren := highlight.InjectionForMatch(config, parentName, config.CombinedInjectionsQuery, *match, source)
-
-					if languageName == "" {
-						injectionsByPatternIndex[match.PatternIndex].languageName = languageName
-					}
-					if contentNode != nil {
-						injectionsByPatternIndex[match.PatternIndex].nodes = append(injectionsByPatternIndex[match.PatternIndex].nodes, *contentNode)
-					}
-					injectionsByPatternIndex[match.PatternIndex].includeChildren = includeChildren
-				}
-
-				for _, injection := range injectionsByPatternIndex {
-					if injection.languageName != "" && len(injection.nodes) > 0 {
-						nextConfig := injectionCallback(injection.languageName)
-						if nextConfig != nil {
-							nextRanges := highlight.IntersectRanges(ranges, injection.nodes, injection.includeChildren)
-							if len(nextRanges) > 0 {
-								queue = append(queue, highlightQueueItem{
-									config: *nextConfig,
-									depth:  depth + 1,
-									ranges: nextRanges,
-								})
-							}
-						}
-					}
-				}
-			}
+			queue = append(queue, combinedInjections(cursor, tree, source, parentName, injectionCallback, config, depth, ranges)...)
 
-			queryCaptures := newQueryCapturesIter(cursor.Captures(config.Query, tree.RootNode(), source))
+			highlighter.RestrictCursor(cursor)
+			queryCaptures := newQueryCapturesIter(cursor.Captures(config.Query, tree.RootNode(), source), config, source)
 			if _, _, ok := queryCaptures.peek(); !ok {
-				continue
-			}
-
-			result = append(result, &iterLayer{
-				Tree:              tree,
-				Cursor:            cursor,
-				Config:            config,
-				HighlightEndStack: nil,
-				ScopeStack: []localScope{
-					{
-						Inherits: false,
-						Range: tree_sitter.Range{
-							StartByte:  0,
-							StartPoint: tree_sitter.NewPoint(0, 0),
-							EndByte:    ^uint(0),
-							EndPoint:   tree_sitter.NewPoint(^uint(0), ^uint(0)),
+				// Nothing to highlight in this layer, so release it right away.
+				if ownsTree {
+					tree.Close()
+				}
+				highlighter.PushCursor(cursor)
+			} else {
+				result = append(result, &iterLayer{
+					Tree:              tree,
+					OwnsTree:          ownsTree,
+					Cursor:            cursor,
+					Config:            config,
+					HighlightEndStack: nil,
+					ScopeStack: []localScope{
+						{
+							Inherits: false,
+							Range: tree_sitter.Range{
+								StartByte:  0,
+								StartPoint: tree_sitter.NewPoint(0, 0),
+								EndByte:    ^uint(0),
+								EndPoint:   tree_sitter.NewPoint(^uint(0), ^uint(0)),
+							},
+							LocalDefs: nil,
 						},
-						LocalDefs: nil,
 					},
-				},
-				Captures: queryCaptures,
-				Ranges:   ranges,
-				Depth:    depth,
-			})
+					Captures: queryCaptures,
+					Ranges:   ranges,
+					Depth:    depth,
+				})
+			}
 		}
 
 		if len(queue) == 0 {
@@ -178,7 +149,7 @@ func NewIterLayers(
 		}
 
 		var next highlightQueueItem
-		next, queue = queue[0], append(queue, queue[1:]...)
+		next, queue = queue[0], queue[1:]
 
 		config = next.config
 		depth = next.depth
@@ -190,6 +161,7 @@ func NewIterLayers(
 
 type iterLayer struct {
 	Tree              *tree_sitter.Tree
+	OwnsTree          bool
 	Cursor            *tree_sitter.QueryCursor
 	Config            types.Configuration
 	HighlightEndStack []uint
@@ -199,6 +171,23 @@ type iterLayer struct {
 	Depth             uint
 }
 
+// close frees the layer's syntax tree, unless it is owned by a [highlight.TreeCache],
+// and returns its cursor to the highlighter. The layer must not be used afterwards.
+func (h *iterLayer) close(highlighter *highlight.Highlighter) {
+	if h.OwnsTree {
+		h.Tree.Close()
+	}
+	highlighter.PushCursor(h.Cursor)
+	h.Tree = nil
+	h.Cursor = nil
+}
+
+func closeLayers(layers []*iterLayer, highlighter *highlight.Highlighter) {
+	for _, layer := range layers {
+		layer.close(highlighter)
+	}
+}
+
 func (h *iterLayer) sortKey() *sortKey {
 	depth := -int(h.Depth)
 
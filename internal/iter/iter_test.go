@@ -0,0 +1,215 @@
+package iter
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// endLayer returns a layer without captures, whose next highlight boundary is
+// the end of a highlight at end.
+func endLayer(end uint) *iterLayer {
+	return &iterLayer{
+		Cursor:            tree_sitter.NewQueryCursor(),
+		Captures:          &queryCapturesIter{peeked: &peekedQueryCapture{}},
+		HighlightEndStack: []uint{end},
+	}
+}
+
+func TestSortLayersKeepsEveryLayer(t *testing.T) {
+	tests := []struct {
+		name string
+		ends []uint
+	}{
+		{name: "sorted", ends: []uint{10, 20, 30, 40}},
+		{name: "first after second", ends: []uint{20, 10, 30, 40}},
+		{name: "first after third", ends: []uint{30, 10, 20, 40}},
+		{name: "first last", ends: []uint{40, 10, 20, 30}},
+		{name: "first before second", ends: []uint{10, 20, 5, 40}},
+		{name: "three layers", ends: []uint{20, 10, 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			highlighter := highlight.NewHighlighter()
+			defer highlighter.Close()
+
+			var layers []*iterLayer
+			for _, end := range tt.ends {
+				layers = append(layers, endLayer(end))
+			}
+			i := &Iterator{
+				Highlighter: highlighter,
+				Layers:      append(make([]*iterLayer, 0, len(layers)+4), layers...),
+			}
+			i.SortLayers()
+
+			if len(i.Layers) != len(layers) {
+				t.Fatalf("got %d layers, want %d", len(i.Layers), len(layers))
+			}
+			seen := make(map[*iterLayer]int)
+			for _, layer := range i.Layers {
+				seen[layer]++
+			}
+			for j, layer := range layers {
+				if seen[layer] != 1 {
+					t.Errorf("layer %d (end %d) is in the layers %d times, want once", j, tt.ends[j], seen[layer])
+				}
+			}
+
+			if t.Failed() {
+				// Closing would close the duplicated layers twice.
+				return
+			}
+			i.Close()
+			for j, layer := range layers {
+				if layer.Cursor != nil {
+					t.Errorf("layer %d (end %d) was not closed", j, tt.ends[j])
+				}
+			}
+		})
+	}
+}
+
+func TestSortLayersOrdersLayersByNextBoundary(t *testing.T) {
+	tests := []struct {
+		name string
+		ends []uint
+		want []uint
+	}{
+		{name: "sorted", ends: []uint{10, 20, 30}, want: []uint{10, 20, 30}},
+		{name: "first after second", ends: []uint{20, 10, 30, 40}, want: []uint{10, 20, 30, 40}},
+		{name: "first after third", ends: []uint{30, 10, 20, 40}, want: []uint{10, 20, 30, 40}},
+		{name: "first last", ends: []uint{40, 10, 20, 30}, want: []uint{10, 20, 30, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			highlighter := highlight.NewHighlighter()
+			defer highlighter.Close()
+
+			i := &Iterator{Highlighter: highlighter}
+			for _, end := range tt.ends {
+				i.Layers = append(i.Layers, endLayer(end))
+			}
+			defer i.Close()
+			i.SortLayers()
+
+			if got := layerEnds(i.Layers); !slices.Equal(got, tt.want) {
+				t.Errorf("got layers ending at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertLayerOrdersLayersByNextBoundary(t *testing.T) {
+	tests := []struct {
+		name   string
+		ends   []uint
+		insert uint
+		want   []uint
+	}{
+		{name: "middle", ends: []uint{10, 20, 40}, insert: 30, want: []uint{10, 20, 30, 40}},
+		{name: "last", ends: []uint{10, 20}, insert: 30, want: []uint{10, 20, 30}},
+		// The first layer is the one being processed, so nothing is inserted before it.
+		{name: "before first", ends: []uint{20, 30}, insert: 10, want: []uint{20, 10, 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			highlighter := highlight.NewHighlighter()
+			defer highlighter.Close()
+
+			i := &Iterator{Highlighter: highlighter}
+			for _, end := range tt.ends {
+				i.Layers = append(i.Layers, endLayer(end))
+			}
+			defer i.Close()
+			i.insertLayer(endLayer(tt.insert))
+
+			if got := layerEnds(i.Layers); !slices.Equal(got, tt.want) {
+				t.Errorf("got layers ending at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func layerEnds(layers []*iterLayer) []uint {
+	var ends []uint
+	for _, layer := range layers {
+		ends = append(ends, layer.HighlightEndStack[len(layer.HighlightEndStack)-1])
+	}
+	return ends
+}
+
+func TestIteratorClosesEveryLayerOnce(t *testing.T) {
+	// Every exec call injects its string as another Python layer, so that the
+	// nested calls are highlighted while the outer layers are still open.
+	source := []byte(`exec("exec('a = 1'); exec('b = 2')")
+exec("exec('''c = 3''')")
+d = 4
+`)
+	cfg := testlang.Config(t, "python")
+	injectionCallback := testlang.InjectionCallback(t)
+
+	highlighter := highlight.NewHighlighter()
+	defer highlighter.Close()
+
+	layers, err := NewIterLayers(context.Background(), source, "", highlighter, injectionCallback, *cfg, 0, []tree_sitter.Range{
+		{
+			StartByte:  0,
+			EndByte:    ^uint(0),
+			StartPoint: tree_sitter.NewPoint(0, 0),
+			EndPoint:   tree_sitter.NewPoint(^uint(0), ^uint(0)),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &Iterator{
+		Ctx:               context.Background(),
+		Source:            source,
+		LanguageName:      cfg.LanguageName,
+		EndByte:           uint(len(source)),
+		Highlighter:       highlighter,
+		InjectionCallback: injectionCallback,
+		Layers:            layers,
+	}
+	i.SortLayers()
+
+	var seen []*iterLayer
+	var maxLayers int
+	for {
+		for _, layer := range i.Layers {
+			if layer.Cursor == nil {
+				t.Fatal("closed layer is still in the layers")
+			}
+			if !slices.Contains(seen, layer) {
+				seen = append(seen, layer)
+			}
+		}
+		maxLayers = max(maxLayers, len(i.Layers))
+
+		event, err := i.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event == nil {
+			break
+		}
+	}
+	i.Close()
+
+	if len(seen) != 6 {
+		t.Errorf("got %d layers, want 6", len(seen))
+	}
+	if maxLayers < 3 {
+		t.Errorf("got at most %d layers at once, want at least 3", maxLayers)
+	}
+	for j, layer := range seen {
+		if layer.Cursor != nil {
+			t.Errorf("layer %d (depth %d) was not closed", j, layer.Depth)
+		}
+	}
+}
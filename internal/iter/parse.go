@@ -0,0 +1,214 @@
+package iter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// Layer is a parsed language layer of a document, either the root language or an injection.
+type Layer struct {
+	Config types.Configuration
+	Depth  uint
+	Ranges []tree_sitter.Range
+	Tree   *tree_sitter.Tree
+	// OldTree is the previous tree this layer was parsed from incrementally, if any.
+	OldTree *tree_sitter.Tree
+}
+
+// OldTreeFunc returns a previous tree for a layer, which has already been edited to match the
+// new source, or nil if there is none.
+type OldTreeFunc func(languageName string, depth uint, ranges []tree_sitter.Range) *tree_sitter.Tree
+
+// parseLayer parses a single layer. The parser's included ranges must already be set.
+// If the tree is taken from the highlighter's [highlight.TreeCache], it is not owned by the caller.
+func parseLayer(
+	ctx context.Context,
+	highlighter *highlight.Highlighter,
+	source []byte,
+	config types.Configuration,
+	ranges []tree_sitter.Range,
+	oldTree *tree_sitter.Tree,
+) (*tree_sitter.Tree, bool, error) {
+	if highlighter.Trees != nil {
+		if tree := highlighter.Trees.Tree(config.LanguageName, ranges); tree != nil {
+			return tree, false, nil
+		}
+	}
+
+	if err := highlighter.Parser.SetLanguage(config.Language); err != nil {
+		return nil, false, fmt.Errorf("error setting language: %w", err)
+	}
+	tree := highlighter.Parser.ParseWithOptions(func(i int, p tree_sitter.Point) []byte {
+		return source[i:]
+	}, oldTree, &tree_sitter.ParseOptions{
+		ProgressCallback: func(tree_sitter.ParseState) bool {
+			return ctx.Err() != nil
+		},
+	})
+	if tree == nil {
+		// Parsing was cancelled, reset the parser so it can be reused.
+		highlighter.Parser.Reset()
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		return nil, false, fmt.Errorf("error parsing %s", config.LanguageName)
+	}
+
+	return tree, true, nil
+}
+
+// combinedInjections returns the layers for all combined injections in the tree.
+func combinedInjections(
+	cursor *tree_sitter.QueryCursor,
+	tree *tree_sitter.Tree,
+	source []byte,
+	parentName string,
+	injectionCallback types.InjectionCallback,
+	config types.Configuration,
+	depth uint,
+	ranges []tree_sitter.Range,
+) []highlightQueueItem {
+	if config.CombinedInjectionsQuery == nil {
+		return nil
+	}
+
+	injectionsByPatternIndex := make([]injectionItem, config.CombinedInjectionsQuery.PatternCount())
+
+	matches := cursor.Matches(config.CombinedInjectionsQuery, tree.RootNode(), source)
+	for {
+		match := matches.Next()
+		if match == nil {
+			break
+		}
+		if !highlight.SatisfiesPredicates(config, config.CombinedInjectionsQuery, match, source) {
+			continue
+		}
+
+		languageName, contentNode, includeChildren, contentRange := highlight.InjectionForMatch(config, parentName, config.CombinedInjectionsQuery, *match, source)
+
+		if languageName != "" {
+			injectionsByPatternIndex[match.PatternIndex].languageName = languageName
+		}
+		if contentNode != nil {
+			injectionsByPatternIndex[match.PatternIndex].ranges = append(injectionsByPatternIndex[match.PatternIndex].ranges, highlight.InjectionRanges(ranges, *contentNode, includeChildren, contentRange)...)
+		}
+	}
+
+	var result []highlightQueueItem
+	for _, injection := range injectionsByPatternIndex {
+		if injection.languageName != "" && len(injection.ranges) > 0 {
+			nextConfig := injectionCallback(injection.languageName)
+			if nextConfig != nil {
+				result = append(result, highlightQueueItem{
+					config: *nextConfig,
+					depth:  depth + 1,
+					ranges: injection.ranges,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// ParseLayers parses the source and, recursively, all of its injections. Unlike [NewIterLayers],
+// which leaves regular injections to the [Iterator], this finds every layer up front.
+// The oldTree function is used to find previous trees for incremental parsing; it may be nil.
+// The caller owns the returned trees.
+func ParseLayers(
+	ctx context.Context,
+	source []byte,
+	parentName string,
+	highlighter *highlight.Highlighter,
+	injectionCallback types.InjectionCallback,
+	config types.Configuration,
+	ranges []tree_sitter.Range,
+	oldTree OldTreeFunc,
+) ([]Layer, error) {
+	var result []Layer
+	queue := []highlightQueueItem{{config: config, depth: 0, ranges: ranges}}
+	for len(queue) > 0 {
+		var item highlightQueueItem
+		item, queue = queue[0], queue[1:]
+
+		if err := highlighter.Parser.SetIncludedRanges(item.ranges); err != nil {
+			continue
+		}
+
+		var old *tree_sitter.Tree
+		if oldTree != nil {
+			old = oldTree(item.config.LanguageName, item.depth, item.ranges)
+		}
+		tree, _, err := parseLayer(ctx, highlighter, source, item.config, item.ranges, old)
+		if err != nil {
+			for _, layer := range result {
+				layer.Tree.Close()
+			}
+			return nil, err
+		}
+		result = append(result, Layer{
+			Config:  item.config,
+			Depth:   item.depth,
+			Ranges:  item.ranges,
+			Tree:    tree,
+			OldTree: old,
+		})
+
+		// Match the parent names the [Iterator] uses, so that the same layers are found.
+		layerParentName := parentName
+		if item.depth > 0 {
+			layerParentName = config.LanguageName
+		}
+
+		cursor := highlighter.PopCursor()
+		queue = append(queue, combinedInjections(cursor, tree, source, layerParentName, injectionCallback, item.config, item.depth, item.ranges)...)
+
+		// Regular injections are found with the injection patterns of the main query.
+		if item.config.InjectionContentCaptureIndex != nil {
+			matches := cursor.Matches(item.config.Query, tree.RootNode(), source)
+			for {
+				match := matches.Next()
+				if match == nil {
+					break
+				}
+				if match.PatternIndex >= item.config.LocalsPatternIndex {
+					continue
+				}
+				if !highlight.SatisfiesPredicates(item.config, item.config.Query, match, source) {
+					continue
+				}
+
+				languageName, contentNode, includeChildren, contentRange := highlight.InjectionForMatch(item.config, config.LanguageName, item.config.Query, *match, source)
+				if languageName == "" || contentNode == nil {
+					continue
+				}
+				nextConfig := injectionCallback(languageName)
+				if nextConfig == nil {
+					continue
+				}
+				nextRanges := highlight.InjectionRanges(item.ranges, *contentNode, includeChildren, contentRange)
+				if len(nextRanges) > 0 {
+					queue = append(queue, highlightQueueItem{
+						config: *nextConfig,
+						depth:  item.depth + 1,
+						ranges: nextRanges,
+					})
+				}
+			}
+		}
+		highlighter.PushCursor(cursor)
+	}
+
+	return result, nil
+}
+
+// EqualRanges reports whether two sets of ranges cover the same bytes.
+func EqualRanges(a []tree_sitter.Range, b []tree_sitter.Range) bool {
+	return slices.EqualFunc(a, b, func(a tree_sitter.Range, b tree_sitter.Range) bool {
+		return a.StartByte == b.StartByte && a.EndByte == b.EndByte
+	})
+}
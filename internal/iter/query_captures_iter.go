@@ -3,6 +3,8 @@ package iter
 import (
 	"slices"
 
+	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
 	tree_sitter "github.com/tree-sitter/go-tree-sitter"
 )
 
@@ -12,24 +14,34 @@ type peekedQueryCapture struct {
 	ok    bool
 }
 
-func newQueryCapturesIter(iter tree_sitter.QueryCaptures) *queryCapturesIter {
-	return &queryCapturesIter{captures: iter}
+func newQueryCapturesIter(iter tree_sitter.QueryCaptures, config types.Configuration, source []byte) *queryCapturesIter {
+	return &queryCapturesIter{captures: iter, config: config, source: source}
 }
 
 // queryCapturesIter allows iterating over the captures of a query while peeking the next capture.
+// Matches that don't satisfy the custom predicates of the configuration are skipped.
 type queryCapturesIter struct {
 	captures tree_sitter.QueryCaptures
+	config   types.Configuration
+	source   []byte
 	peeked   *peekedQueryCapture
 }
 
 func (q *queryCapturesIter) next() (tree_sitter.QueryMatch, uint, bool) {
-	match, index := q.captures.Next()
-	if match == nil {
-		return tree_sitter.QueryMatch{}, index, false
-	}
+	for {
+		match, index := q.captures.Next()
+		if match == nil {
+			return tree_sitter.QueryMatch{}, index, false
+		}
+		if !highlight.SatisfiesPredicates(q.config, q.config.Query, match, q.source) {
+			// Remove the match so that none of its other captures are returned.
+			match.Remove()
+			continue
+		}
 
-	match.Captures = slices.Clone(match.Captures)
-	return *match, index, true
+		match.Captures = slices.Clone(match.Captures)
+		return *match, index, true
+	}
 }
 
 func (q *queryCapturesIter) Next() (tree_sitter.QueryMatch, uint, bool) {
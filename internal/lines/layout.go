@@ -0,0 +1,132 @@
+package lines
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+const (
+	tabGlyph   = "→"
+	spaceGlyph = "·"
+)
+
+// Layout keeps track of the column of the output, to expand tabs and mark whitespace. The zero
+// value leaves whitespace as it is.
+type Layout struct {
+	options types.Whitespace
+	column  int
+	// next is the offset in the source after the last text.
+	next int
+	// runEnd is the end of the current run of tabs and spaces, and trailing
+	// reports whether it is at the end of a line.
+	runEnd   int
+	trailing bool
+}
+
+// NewLayout creates a layout for the whitespace options.
+func NewLayout(options types.Whitespace) Layout {
+	return Layout{options: options}
+}
+
+// Active reports whether tabs and spaces need to be written with [Layout.Whitespace].
+func (l *Layout) Active() bool {
+	return l.options.TabWidth > 0 || l.options.Tabs || l.options.Spaces || l.options.Trailing
+}
+
+// Text moves over the text from start to end, which has no line breaks, tabs or spaces.
+func (l *Layout) Text(source string, start int, end int) {
+	if !l.Active() || start == end {
+		return
+	}
+	l.seek(source, start)
+	l.column += utf8.RuneCountInString(source[start:end])
+	l.next = end
+}
+
+// Replaced moves over the character at offset i, which is written as text, like a carriage
+// return written as `␍`.
+func (l *Layout) Replaced(source string, i int, text string) {
+	if !l.Active() {
+		return
+	}
+	l.seek(source, i)
+	l.column += utf8.RuneCountInString(text)
+	l.next = i + 1
+}
+
+// LineBreak moves over the line break at offset i.
+func (l *Layout) LineBreak(i int) {
+	l.column = 0
+	l.next = i + 1
+}
+
+// Whitespace returns the text to write for the tab or space at offset i, and the kinds of
+// whitespace it is if it is marked: `tab` or `space`, and `trailing` at the end of a line.
+func (l *Layout) Whitespace(source string, i int) (string, []string) {
+	l.seek(source, i)
+	l.next = i + 1
+
+	if i >= l.runEnd {
+		l.runEnd = i + len(source[i:]) - len(strings.TrimLeft(source[i:], " \t"))
+		l.trailing = l.runEnd == len(source) || source[l.runEnd] == '\n' || source[l.runEnd] == '\r'
+	}
+
+	tab := source[i] == '\t'
+	trailing := l.trailing && l.options.Trailing
+	marked := trailing || (tab && l.options.Tabs) || (!tab && l.options.Spaces)
+
+	var kinds []string
+	if marked {
+		kinds = []string{"space"}
+		if tab {
+			kinds = []string{"tab"}
+		}
+		if trailing {
+			kinds = append(kinds, "trailing")
+		}
+	}
+
+	if !tab {
+		l.column++
+		if marked && l.options.Glyphs {
+			return spaceGlyph, kinds
+		}
+		return " ", kinds
+	}
+
+	if l.options.TabWidth <= 0 {
+		l.column++
+		if marked && l.options.Glyphs {
+			return tabGlyph, kinds
+		}
+		return "\t", kinds
+	}
+
+	width := l.options.TabWidth - l.column%l.options.TabWidth
+	l.column += width
+	if marked && l.options.Glyphs {
+		return tabGlyph + strings.Repeat(" ", width-1), kinds
+	}
+	return strings.Repeat(" ", width), kinds
+}
+
+// seek moves to offset i, counting the columns from the start of its line if the text before it
+// wasn't written, e.g. at the start of a window of the source.
+func (l *Layout) seek(source string, i int) {
+	if i == l.next {
+		return
+	}
+
+	lineStart := strings.LastIndexAny(source[:i], "\r\n") + 1
+	l.column = 0
+	for _, r := range source[lineStart:i] {
+		if r == '\t' && l.options.TabWidth > 0 {
+			l.column += l.options.TabWidth - l.column%l.options.TabWidth
+		} else {
+			l.column++
+		}
+	}
+	l.next = i
+}
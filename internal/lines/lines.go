@@ -0,0 +1,175 @@
+package lines
+
+import (
+	"iter"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// Split splits a stream of highlight events into lines. The events of every line are balanced:
+// each line starts with the layer and start events of all captures that are open at its start,
+// and ends with the matching end events. Source events don't include the line break itself.
+// A line break at the very end of the source, or of the highlighted part of it, doesn't start a
+// new line. Lines end at `\n`, and at a lone `\r` if it is written as a line break with the given
+// line endings, see [CarriageReturn].
+//
+// Layer events don't nest like capture events: the highlighter emits an [events.EventLayerEnd]
+// before every [events.EventLayerStart] but the first, when it switches to another layer, and
+// captures stay open across the switch. So every line starts with the layer of its first open
+// capture, switches layers before each reopened capture of another layer, and ends with an
+// [events.EventLayerEnd] for the layer it is in.
+func Split(highlightEvents iter.Seq2[events.Event, error], source string, lineEndings types.LineEndings) iter.Seq2[[]events.Event, error] {
+	return func(yield func([]events.Event, error) bool) {
+		var (
+			// layer is the layer that is currently highlighted, if inLayer is set.
+			layer   events.EventLayerStart
+			inLayer bool
+			// captures are the captures that are currently open.
+			captures  []openCapture
+			line      []events.Event
+			lineStart uint
+			// end is the end of the last source event, which is the end of the source
+			// unless only part of it was highlighted.
+			end uint
+		)
+
+		closeLine := func() {
+			for range captures {
+				line = append(line, events.EventCaptureEnd{})
+			}
+			if inLayer {
+				line = append(line, events.EventLayerEnd{})
+			}
+		}
+
+		// reopen starts a line with the layers and captures that are open.
+		reopen := func() {
+			var lineLayer *events.EventLayerStart
+			switchLayer := func(to events.EventLayerStart) {
+				if lineLayer != nil {
+					if *lineLayer == to {
+						return
+					}
+					line = append(line, events.EventLayerEnd{})
+				}
+				line = append(line, to)
+				lineLayer = &to
+			}
+			for _, capture := range captures {
+				switchLayer(capture.layer)
+				line = append(line, capture.start)
+			}
+			if inLayer {
+				switchLayer(layer)
+			} else if lineLayer != nil {
+				line = append(line, events.EventLayerEnd{})
+			}
+		}
+
+		for event, err := range highlightEvents {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			switch e := event.(type) {
+			case events.EventLayerStart:
+				layer, inLayer = e, true
+				line = append(line, event)
+			case events.EventLayerEnd:
+				inLayer = false
+				line = append(line, event)
+			case events.EventCaptureStart:
+				captures = append(captures, openCapture{start: e, layer: layer})
+				line = append(line, event)
+			case events.EventCaptureEnd:
+				captures = captures[:len(captures)-1]
+				line = append(line, event)
+			case events.EventSource:
+				end = e.EndByte
+				start := e.StartByte
+				for {
+					i := nextBreak(source, int(start), int(e.EndByte), lineEndings)
+					if i == -1 {
+						break
+					}
+					newline := uint(i)
+					if start < newline {
+						line = append(line, events.EventSource{StartByte: start, EndByte: newline})
+					}
+					closeLine()
+					if !yield(line, nil) {
+						return
+					}
+					line = nil
+					reopen()
+					start = newline + 1
+					lineStart = start
+				}
+				if start < e.EndByte {
+					line = append(line, events.EventSource{StartByte: start, EndByte: e.EndByte})
+				}
+			}
+		}
+
+		if lineStart < end {
+			closeLine()
+			yield(line, nil)
+		}
+	}
+}
+
+// openCapture is a capture that is open, with the layer it was started in.
+type openCapture struct {
+	start events.EventCaptureStart
+	layer events.EventLayerStart
+}
+
+// nextBreak returns the offset of the next line break in source[start:end], or -1 if there is none.
+func nextBreak(source string, start int, end int, lineEndings types.LineEndings) int {
+	for i := start; i < end; i++ {
+		switch source[i] {
+		case '\n':
+			return i
+		case '\r':
+			if _, lineBreak := CarriageReturn(lineEndings, source, i); lineBreak {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Offset returns the byte offset of the start of the 0-based line, or the length of the source if
+// it has fewer lines. Lines end like in [Split].
+func Offset(source string, line int, lineEndings types.LineEndings) uint {
+	var offset int
+	for range max(line, 0) {
+		i := nextBreak(source, offset, len(source), lineEndings)
+		if i == -1 {
+			return uint(len(source))
+		}
+		offset = i + 1
+	}
+	return uint(offset)
+}
+
+// CarriageReturn returns the text to write for the `\r` at offset i of the source with the given
+// line endings, and whether it is a line break. A `\r` that is a line break also ends a line in
+// [Split], so that line numbers count the lines as they are written. The rows of tree-sitter only
+// end at `\n`.
+func CarriageReturn(lineEndings types.LineEndings, source string, i int) (string, bool) {
+	switch lineEndings {
+	case types.LineEndingsPreserve:
+		return "\r", false
+	case types.LineEndingsVisible:
+		return "␍", false
+	default:
+		if i+1 < len(source) && source[i+1] == '\n' {
+			// The `\n` is the line break.
+			return "", false
+		}
+		return "\n", true
+	}
+}
@@ -0,0 +1,226 @@
+package lines
+
+import (
+	"errors"
+	"iter"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/events"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// layerStart, captureStart and text build the events of the tests.
+func layerStart(languageName string) events.Event {
+	return events.EventLayerStart{LanguageName: languageName}
+}
+
+func captureStart(name string) events.Event {
+	return events.EventCaptureStart{Name: name}
+}
+
+func text(start uint, end uint) events.Event {
+	return events.EventSource{StartByte: start, EndByte: end}
+}
+
+var (
+	layerEnd   events.Event = events.EventLayerEnd{}
+	captureEnd events.Event = events.EventCaptureEnd{}
+)
+
+// seq returns the events as a stream without errors.
+func seq(highlightEvents []events.Event) iter.Seq2[events.Event, error] {
+	return func(yield func(events.Event, error) bool) {
+		for _, event := range highlightEvents {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
+
+// format writes the events of a line as `<lang>` and `</>` for layers, `[name]` and `[/]` for
+// captures and the text of the source events.
+func format(line []events.Event, source string) string {
+	var s strings.Builder
+	for _, event := range line {
+		switch e := event.(type) {
+		case events.EventLayerStart:
+			s.WriteString("<" + e.LanguageName + ">")
+		case events.EventLayerEnd:
+			s.WriteString("</>")
+		case events.EventCaptureStart:
+			s.WriteString("[" + e.Name + "]")
+		case events.EventCaptureEnd:
+			s.WriteString("[/]")
+		case events.EventSource:
+			s.WriteString(source[e.StartByte:e.EndByte])
+		}
+	}
+	return s.String()
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		events      []events.Event
+		lineEndings types.LineEndings
+		want        []string
+	}{
+		{
+			name:   "no captures",
+			source: "a\nb\n",
+			events: []events.Event{layerStart("go"), text(0, 4)},
+			want:   []string{"<go>a</>", "<go>b</>"},
+		},
+		{
+			name:   "capture across lines",
+			source: "/* a\nb */\nc",
+			events: []events.Event{layerStart("go"), captureStart("comment"), text(0, 9), captureEnd, text(9, 11)},
+			want:   []string{"<go>[comment]/* a[/]</>", "<go>[comment]b */[/]</>", "<go>c</>"},
+		},
+		{
+			name:   "nested captures across lines",
+			source: "a\nb\nc",
+			events: []events.Event{layerStart("go"), captureStart("outer"), text(0, 1), captureStart("inner"), text(1, 4), captureEnd, text(4, 5), captureEnd},
+			want:   []string{"<go>[outer]a[inner][/][/]</>", "<go>[outer][inner]b[/][/]</>", "<go>[outer][inner][/]c[/]</>"},
+		},
+		{
+			// The highlighter switches layers with a layer end and a layer start, and the
+			// capture of the outer layer stays open across the injection.
+			name:   "capture across an injection",
+			source: "x(\"a\nb\")\ny",
+			events: []events.Event{
+				layerStart("python"), captureStart("string"), text(0, 3),
+				layerEnd, layerStart("js"), captureStart("variable"), text(3, 4), captureEnd, text(4, 5), captureStart("variable"), text(5, 6), captureEnd,
+				layerEnd, layerStart("python"), text(6, 7), captureEnd, text(7, 10),
+			},
+			want: []string{
+				"<python>[string]x(\"</><js>[variable]a[/][/]</>",
+				"<python>[string]</><js>[variable]b[/]</><python>\"[/])</>",
+				"<python>y</>",
+			},
+		},
+		{
+			name:   "line break in an injection",
+			source: "a\nb",
+			events: []events.Event{layerStart("html"), layerEnd, layerStart("js"), text(0, 3)},
+			want:   []string{"<html></><js>a</>", "<js>b</>"},
+		},
+		{
+			name:   "line break at the end",
+			source: "a\n",
+			events: []events.Event{layerStart("go"), text(0, 2)},
+			want:   []string{"<go>a</>"},
+		},
+		{
+			name:   "empty lines",
+			source: "a\n\n\nb",
+			events: []events.Event{layerStart("go"), text(0, 5)},
+			want:   []string{"<go>a</>", "<go></>", "<go></>", "<go>b</>"},
+		},
+		{
+			name:   "carriage returns",
+			source: "a\rb\r\nc",
+			events: []events.Event{layerStart("go"), text(0, 6)},
+			want:   []string{"<go>a</>", "<go>b\r</>", "<go>c</>"},
+		},
+		{
+			name:        "preserved carriage returns",
+			source:      "a\rb\r\nc",
+			events:      []events.Event{layerStart("go"), text(0, 6)},
+			lineEndings: types.LineEndingsPreserve,
+			want:        []string{"<go>a\rb\r</>", "<go>c</>"},
+		},
+		{
+			name:   "part of the source",
+			source: "a\nb\nc\n",
+			events: []events.Event{layerStart("go"), text(2, 4)},
+			want:   []string{"<go>b</>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for line, err := range Split(seq(tt.events), tt.source, tt.lineEndings) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, format(line, tt.source))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got lines\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitError(t *testing.T) {
+	errTest := errors.New("test error")
+	highlightEvents := func(yield func(events.Event, error) bool) {
+		_ = yield(layerStart("go"), nil) && yield(text(0, 2), nil) && yield(nil, errTest)
+	}
+
+	var lines int
+	for _, err := range Split(highlightEvents, "a\nb", types.LineEndingsNormalize) {
+		if err != nil {
+			if !errors.Is(err, errTest) {
+				t.Errorf("got error %v, want %v", err, errTest)
+			}
+			if lines != 1 {
+				t.Errorf("got the error after %d lines, want 1", lines)
+			}
+			return
+		}
+		lines++
+	}
+	t.Error("got no error")
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		source      string
+		line        int
+		lineEndings types.LineEndings
+		want        uint
+	}{
+		{source: "a\nb\nc", line: 0, want: 0},
+		{source: "a\nb\nc", line: 2, want: 4},
+		{source: "a\nb\nc", line: 3, want: 5},
+		{source: "a\nb\nc", line: -1, want: 0},
+		{source: "a\rb\r\nc", line: 1, want: 2},
+		{source: "a\rb\r\nc", line: 2, want: 5},
+		{source: "a\rb\r\nc", line: 1, lineEndings: types.LineEndingsPreserve, want: 5},
+		{source: "a\rb\r\nc", line: 1, lineEndings: types.LineEndingsVisible, want: 5},
+	}
+	for _, tt := range tests {
+		if got := Offset(tt.source, tt.line, tt.lineEndings); got != tt.want {
+			t.Errorf("Offset(%q, %d, %d) = %d, want %d", tt.source, tt.line, tt.lineEndings, got, tt.want)
+		}
+	}
+}
+
+func TestCarriageReturn(t *testing.T) {
+	tests := []struct {
+		source        string
+		lineEndings   types.LineEndings
+		want          string
+		wantLineBreak bool
+	}{
+		{source: "\r", lineEndings: types.LineEndingsNormalize, want: "\n", wantLineBreak: true},
+		{source: "\ra", lineEndings: types.LineEndingsNormalize, want: "\n", wantLineBreak: true},
+		{source: "\r\n", lineEndings: types.LineEndingsNormalize, want: ""},
+		{source: "\r", lineEndings: types.LineEndingsPreserve, want: "\r"},
+		{source: "\r\n", lineEndings: types.LineEndingsPreserve, want: "\r"},
+		{source: "\r", lineEndings: types.LineEndingsVisible, want: "␍"},
+		{source: "\r\n", lineEndings: types.LineEndingsVisible, want: "␍"},
+	}
+	for _, tt := range tests {
+		got, lineBreak := CarriageReturn(tt.lineEndings, tt.source, 0)
+		if got != tt.want || lineBreak != tt.wantLineBreak {
+			t.Errorf("CarriageReturn(%d, %q) = %q, %t, want %q, %t", tt.lineEndings, tt.source, got, lineBreak, tt.want, tt.wantLineBreak)
+		}
+	}
+}
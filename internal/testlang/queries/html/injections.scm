@@ -0,0 +1,12 @@
+((script_element
+  (start_tag
+    (attribute
+      (attribute_name) @_attribute
+      (quoted_attribute_value
+        (attribute_value) @injection.language)))
+  (raw_text) @injection.content)
+ (#eq? @_attribute "type"))
+
+((style_element
+  (raw_text) @injection.content)
+ (#set! injection.language "css"))
@@ -0,0 +1,42 @@
+; Later patterns take precedence, so the most general ones come first.
+(identifier) @variable
+
+(comment) @comment
+(string) @string
+(escape_sequence) @string.escape
+
+[
+  (integer)
+  (float)
+] @number
+
+[
+  (true)
+  (false)
+  (none)
+] @constant.builtin
+
+(function_definition
+  name: (identifier) @function)
+
+((identifier) @function.builtin
+ (#is-not? local)
+ (#match? @function.builtin "^(exec|len|print)$"))
+
+(parameters
+  (identifier) @variable.parameter)
+
+[
+  "class"
+  "def"
+  "for"
+  "in"
+  "lambda"
+  "return"
+] @keyword
+
+[
+  "="
+  "+"
+  "*"
+] @operator
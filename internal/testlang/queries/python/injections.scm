@@ -0,0 +1,7 @@
+((call
+  function: (identifier) @_function
+  arguments: (argument_list
+    (string
+      (string_content) @injection.content)))
+ (#eq? @_function "exec")
+ (#set! injection.language "python"))
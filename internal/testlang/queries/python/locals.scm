@@ -0,0 +1,17 @@
+(function_definition) @local.scope
+(lambda) @local.scope
+
+((class_definition) @local.scope
+ (#set! local.scope-inherits false))
+
+(parameters
+  (identifier) @local.definition)
+
+(lambda_parameters
+  (identifier) @local.definition)
+
+(assignment
+  left: (identifier) @local.definition
+  right: (_) @local.definition-value)
+
+(identifier) @local.reference
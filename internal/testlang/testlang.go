@@ -0,0 +1,117 @@
+// Package testlang provides languages with real grammars for tests. Their
+// queries are small test queries in the queries directory, not the queries of
+// the grammar repositories.
+package testlang
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"path"
+	"sync"
+	"unsafe"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/config"
+	"github.com/noclaps/go-tree-sitter-highlight/language"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter_embedded_template "github.com/tree-sitter/tree-sitter-embedded-template/bindings/go"
+	tree_sitter_html "github.com/tree-sitter/tree-sitter-html/bindings/go"
+	tree_sitter_json "github.com/tree-sitter/tree-sitter-json/bindings/go"
+	tree_sitter_python "github.com/tree-sitter/tree-sitter-python/bindings/go"
+)
+
+//go:embed queries
+var queries embed.FS
+
+var grammars = map[string]func() unsafe.Pointer{
+	"embedded_template": tree_sitter_embedded_template.Language,
+	"html":              tree_sitter_html.Language,
+	"json":              tree_sitter_json.Language,
+	"python":            tree_sitter_python.Language,
+}
+
+// Names are the capture names used by the test queries.
+var Names = []string{
+	"attribute",
+	"comment",
+	"constant",
+	"constant.builtin",
+	"function",
+	"function.builtin",
+	"keyword",
+	"number",
+	"operator",
+	"punctuation.bracket",
+	"string",
+	"string.escape",
+	"string.special.key",
+	"tag",
+	"tag.error",
+	"variable",
+	"variable.parameter",
+}
+
+// Language returns a language by name, with its test queries. It panics if
+// there is no grammar for the language.
+func Language(name string) language.Language {
+	grammar, ok := grammars[name]
+	if !ok {
+		panic("testlang: unknown language " + name)
+	}
+	return language.NewLanguage(name, grammar(), readQuery(name, "highlights"), readQuery(name, "injections"), readQuery(name, "locals"))
+}
+
+func readQuery(name string, kind string) []byte {
+	query, err := queries.ReadFile(path.Join("queries", name, kind+".scm"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		panic(err)
+	}
+	return query
+}
+
+// TB is the part of [testing.TB] that the helpers use, so that this package
+// doesn't import testing outside of tests.
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...any)
+}
+
+var (
+	configsMu sync.Mutex
+	configs   = make(map[string]*types.Configuration)
+)
+
+// Config returns the configuration of a language by name, which recognises
+// [Names]. Configurations are shared between tests, so they must not be
+// changed.
+func Config(t TB, name string) *types.Configuration {
+	t.Helper()
+
+	configsMu.Lock()
+	defer configsMu.Unlock()
+
+	if cfg, ok := configs[name]; ok {
+		return cfg
+	}
+	lang := Language(name)
+	cfg, err := config.New(lang.Lang, lang.Name, lang.HighlightsQuery, lang.InjectionQuery, lang.LocalsQuery, Names)
+	if err != nil {
+		t.Fatalf("error creating configuration for %s: %s", name, err)
+	}
+	configs[name] = cfg
+	return cfg
+}
+
+// InjectionCallback returns the configurations of the languages with a
+// grammar by their name or MIME type, see [language.NormalizeName], and nil
+// for all other languages.
+func InjectionCallback(t TB) types.InjectionCallback {
+	t.Helper()
+
+	return language.NormalizedInjectionCallback(func(languageName string) *types.Configuration {
+		if _, ok := grammars[languageName]; !ok {
+			return nil
+		}
+		return Config(t, languageName)
+	})
+}
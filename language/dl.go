@@ -0,0 +1,48 @@
+//go:build unix
+
+package language
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+
+static const void *call_language_fn(void *fn) {
+	return ((const void *(*)(void))fn)();
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// OpenLibrary opens a compiled tree-sitter grammar, a shared library, with
+// `dlopen` and returns the language from its `tree_sitter_<name>` function,
+// for [NewLanguage]. Dashes in the name are replaced with underscores. Once
+// the language is found, the library is never closed, since the language can
+// be in use until the program exits.
+func OpenLibrary(path string, name string) (unsafe.Pointer, error) {
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+
+	handle := C.dlopen(cPath, C.RTLD_NOW|C.RTLD_LOCAL)
+	if handle == nil {
+		return nil, fmt.Errorf("error opening %s: %s", path, C.GoString(C.dlerror()))
+	}
+
+	symbol := "tree_sitter_" + strings.ReplaceAll(name, "-", "_")
+	cSymbol := C.CString(symbol)
+	defer C.free(unsafe.Pointer(cSymbol))
+
+	fn := C.dlsym(handle, cSymbol)
+	if fn == nil {
+		err := fmt.Errorf("error finding %s in %s: %s", symbol, path, C.GoString(C.dlerror()))
+		C.dlclose(handle)
+		return nil, err
+	}
+
+	return unsafe.Pointer(C.call_language_fn(fn)), nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package language
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// OpenLibrary opens a compiled tree-sitter grammar. Loading shared libraries
+// is only supported on Unix systems.
+func OpenLibrary(path string, name string) (unsafe.Pointer, error) {
+	return nil, errors.New("loading shared libraries is not supported on this platform")
+}
@@ -0,0 +1,312 @@
+package language
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// grammarConfig is a grammar entry in a `tree-sitter.json` file.
+type grammarConfig struct {
+	Name           string     `json:"name"`
+	Scope          string     `json:"scope"`
+	Path           string     `json:"path"`
+	FileTypes      []string   `json:"file-types"`
+	Highlights     stringList `json:"highlights"`
+	Injections     stringList `json:"injections"`
+	Locals         stringList `json:"locals"`
+	InjectionRegex string     `json:"injection-regex"`
+	FirstLineRegex string     `json:"first-line-regex"`
+}
+
+// stringList is a JSON value that is either a single string or an array of strings.
+type stringList []string
+
+func (s *stringList) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = stringList{str}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// LoadGrammarDir loads the languages of a tree-sitter grammar repository from
+// its `tree-sitter.json` file. The parser for each grammar is looked up by
+// name with the lang function, usually from the grammar's Go bindings.
+//
+// The query files listed in the `highlights`, `injections` and `locals`
+// fields are read and concatenated in order. If a field is missing, the file
+// with the default name in the `queries` directory is used if it exists.
+// `; inherits:` directives are resolved as described in [ReadQueryFiles],
+// looking in queryDirs after the directory containing the query file.
+//
+// The returned entries can be added to a [Registry]. Their extensions and
+// filenames come from `file-types`, which are file names or extensions, see
+// [fileTypeIsFilename]. `injection-regex` is used as their
+// [Entry.InjectionRegex], and `scope` as their [Entry.Scope].
+func LoadGrammarDir(dir string, lang func(name string) unsafe.Pointer, queryDirs ...string) ([]Entry, error) {
+	grammars, err := readGrammarConfigs(filepath.Join(dir, "tree-sitter.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(grammars))
+	for _, grammar := range grammars {
+		ptr := lang(grammar.Name)
+		if ptr == nil {
+			return nil, fmt.Errorf("no parser for grammar %s", grammar.Name)
+		}
+
+		grammarDir := filepath.Join(dir, grammar.Path)
+		queries := make([][]byte, 3)
+		for i, kind := range []struct {
+			name  string
+			paths stringList
+		}{
+			{"highlights", grammar.Highlights},
+			{"injections", grammar.Injections},
+			{"locals", grammar.Locals},
+		} {
+			var paths []string
+			for _, p := range kind.paths {
+				paths = append(paths, resolveQueryPath(dir, grammarDir, p))
+			}
+			if len(paths) == 0 {
+				defaultPath := resolveQueryPath(dir, grammarDir, filepath.Join("queries", kind.name+".scm"))
+				if _, err := os.Stat(defaultPath); err == nil {
+					paths = append(paths, defaultPath)
+				}
+			}
+
+			query, err := ReadQueryFiles(paths, queryDirs...)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s queries for %s: %w", kind.name, grammar.Name, err)
+			}
+			queries[i] = query
+		}
+
+		entry, err := grammar.entry(NewLanguage(grammar.Name, ptr, queries[0], queries[1], queries[2]))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// readGrammarConfigs reads the grammars of a `tree-sitter.json` file.
+func readGrammarConfigs(path string) ([]grammarConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tree-sitter.json: %w", err)
+	}
+
+	var config struct {
+		Grammars []grammarConfig `json:"grammars"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing tree-sitter.json: %w", err)
+	}
+	return config.Grammars, nil
+}
+
+// entry returns the registry entry of the language of the grammar, with the
+// file types, scope and regular expressions of the grammar.
+func (g grammarConfig) entry(lang Language) (Entry, error) {
+	entry := Entry{
+		Language: lang,
+		Scope:    g.Scope,
+	}
+	for _, fileType := range g.FileTypes {
+		if fileTypeIsFilename(fileType) {
+			entry.Filenames = append(entry.Filenames, fileType)
+		} else {
+			entry.Extensions = append(entry.Extensions, fileType)
+		}
+	}
+
+	var err error
+	if g.InjectionRegex != "" {
+		entry.InjectionRegex, err = regexp.Compile(g.InjectionRegex)
+		if err != nil {
+			return Entry{}, fmt.Errorf("error compiling injection-regex for %s: %w", g.Name, err)
+		}
+	}
+	if g.FirstLineRegex != "" {
+		entry.FirstLine, err = regexp.Compile(g.FirstLineRegex)
+		if err != nil {
+			return Entry{}, fmt.Errorf("error compiling first-line-regex for %s: %w", g.Name, err)
+		}
+	}
+	return entry, nil
+}
+
+// fileTypeIsFilename reports whether an entry of `file-types` is a file name,
+// like "Makefile", "CMakeLists.txt" or ".bashrc", instead of an extension.
+// tree-sitter matches file types against both, but here they are one or the
+// other: file names start with a dot or an upper case letter, so that
+// extensions like "go" don't match files with that name, and files like
+// "x.Makefile" don't match "Makefile". Single upper case letters, like "R",
+// are extensions.
+func fileTypeIsFilename(fileType string) bool {
+	return strings.HasPrefix(fileType, ".") || len(fileType) > 1 && fileType[0] >= 'A' && fileType[0] <= 'Z'
+}
+
+// LoadQueryDir loads a language from a directory of query files laid out like
+// nvim-treesitter, where the queries for a language are in
+// `<dir>/<name>/highlights.scm`, `<dir>/<name>/injections.scm` and
+// `<dir>/<name>/locals.scm`. Missing files are treated as empty queries.
+func LoadQueryDir(dir string, name string, ptr unsafe.Pointer) (Language, error) {
+	queries := make([][]byte, 3)
+	for i, kind := range []string{"highlights", "injections", "locals"} {
+		var paths []string
+		p := filepath.Join(dir, name, kind+".scm")
+		if _, err := os.Stat(p); err == nil {
+			paths = append(paths, p)
+		}
+
+		query, err := ReadQueryFiles(paths, dir)
+		if err != nil {
+			return Language{}, fmt.Errorf("error reading %s queries for %s: %w", kind, name, err)
+		}
+		queries[i] = query
+	}
+
+	return NewLanguage(name, ptr, queries[0], queries[1], queries[2]), nil
+}
+
+// ReadQueryFiles reads the given query files and concatenates them in order.
+//
+// Query files can start with an nvim-treesitter style `; inherits: a,b`
+// directive. The same kind of query file (e.g. `highlights.scm`) of each
+// inherited language is then included before the file itself. Inherited
+// files are looked up as `<language>/<file>` next to the directory of the
+// query file, and then in each of the queryDirs. Optional inherits, written
+// in parentheses like `; inherits: (jsx)`, are skipped if they can't be found.
+func ReadQueryFiles(paths []string, queryDirs ...string) ([]byte, error) {
+	var result []byte
+	for _, p := range paths {
+		query, err := readQueryFile(p, queryDirs, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, query...)
+	}
+	return result, nil
+}
+
+func readQueryFile(p string, queryDirs []string, seen []string) ([]byte, error) {
+	if slices.Contains(seen, p) {
+		return nil, fmt.Errorf("query files inherit from each other: %s", strings.Join(append(seen, p), " -> "))
+	}
+	seen = append(seen, p)
+
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []byte
+	for _, inherited := range inherits(data) {
+		optional := strings.HasPrefix(inherited, "(") && strings.HasSuffix(inherited, ")")
+		inherited = strings.Trim(inherited, "()")
+
+		inheritedPath, ok := findInheritedQuery(p, inherited, queryDirs)
+		if !ok {
+			if optional {
+				continue
+			}
+			return nil, fmt.Errorf("error resolving inherited queries %s for %s: %w", inherited, p, fs.ErrNotExist)
+		}
+
+		query, err := readQueryFile(inheritedPath, queryDirs, seen)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, query...)
+	}
+
+	result = append(result, data...)
+	if len(result) > 0 && result[len(result)-1] != '\n' {
+		result = append(result, '\n')
+	}
+	return result, nil
+}
+
+var inheritsDirective = regexp.MustCompile(`^;+\s*inherits\s*:?\s*(.*)$`)
+
+// inherits returns the languages listed in the `; inherits:` directives of
+// the leading comment lines of a query file.
+func inherits(query []byte) []string {
+	var result []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(query))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ";") {
+			break
+		}
+
+		match := inheritsDirective.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		for name := range strings.SplitSeq(match[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				result = append(result, name)
+			}
+		}
+	}
+
+	return result
+}
+
+func findInheritedQuery(p string, language string, queryDirs []string) (string, bool) {
+	file := filepath.Base(p)
+	dirs := append([]string{filepath.Dir(filepath.Dir(p))}, queryDirs...)
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, language, file)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// resolveQueryPath resolves a query path from `tree-sitter.json`, which is
+// relative to the repository root, or for some grammars to the grammar path.
+func resolveQueryPath(dir string, grammarDir string, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+
+	candidate := filepath.Join(dir, p)
+	if _, err := os.Stat(candidate); errors.Is(err, fs.ErrNotExist) {
+		if grammarCandidate := filepath.Join(grammarDir, p); grammarCandidate != candidate {
+			if _, err := os.Stat(grammarCandidate); err == nil {
+				return grammarCandidate
+			}
+		}
+	}
+	return candidate
+}
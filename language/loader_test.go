@@ -0,0 +1,100 @@
+package language_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"unsafe"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/language"
+	tree_sitter_python "github.com/tree-sitter/tree-sitter-python/bindings/go"
+)
+
+func TestLoadGrammarDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tree-sitter.json": `{
+  "grammars": [
+    {
+      "name": "python",
+      "scope": "source.python",
+      "file-types": ["py", "pyi", "R", "SConstruct", "Makefile", "CMakeLists.txt", ".pythonrc"],
+      "injection-regex": "^py(thon)?$",
+      "highlights": ["queries/base.scm", "queries/highlights.scm"]
+    }
+  ]
+}`,
+		"queries/base.scm":       "(comment) @comment\n",
+		"queries/highlights.scm": "; inherits: (missing)\n(string) @string",
+		"queries/injections.scm": "",
+		"queries/locals.scm":     "(identifier) @local.reference\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := language.LoadGrammarDir(dir, func(name string) unsafe.Pointer {
+		if name != "python" {
+			return nil
+		}
+		return tree_sitter_python.Language()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+
+	// File types are either extensions or file names, not both.
+	if want := []string{"py", "pyi", "R"}; !slices.Equal(entry.Extensions, want) {
+		t.Errorf("got extensions %q, want %q", entry.Extensions, want)
+	}
+	if want := []string{"SConstruct", "Makefile", "CMakeLists.txt", ".pythonrc"}; !slices.Equal(entry.Filenames, want) {
+		t.Errorf("got filenames %q, want %q", entry.Filenames, want)
+	}
+	if entry.Scope != "source.python" {
+		t.Errorf("got scope %q, want %q", entry.Scope, "source.python")
+	}
+	if entry.InjectionRegex == nil || !entry.InjectionRegex.MatchString("py") {
+		t.Errorf("got injection regex %v, want one that matches py", entry.InjectionRegex)
+	}
+	if want := "(comment) @comment\n; inherits: (missing)\n(string) @string\n"; string(entry.Language.HighlightsQuery) != want {
+		t.Errorf("got highlights query %q, want %q", entry.Language.HighlightsQuery, want)
+	}
+	if want := "(identifier) @local.reference\n"; string(entry.Language.LocalsQuery) != want {
+		t.Errorf("got locals query %q, want %q", entry.Language.LocalsQuery, want)
+	}
+
+	registry := language.NewRegistry(testlang.Names)
+	registry.Register(entry)
+	for path, want := range map[string]bool{
+		"main.py":            true,
+		"analysis.R":         true,
+		"dir/SConstruct":     true,
+		"Makefile":           true,
+		"dir/CMakeLists.txt": true,
+		"home/.pythonrc":     true,
+		"py":                 false,
+		"dir/pyi":            false,
+		"dir/R":              false,
+		"main.go":            false,
+		"dir/.pythonrc.go":   false,
+		"x.SConstruct":       false,
+		"build.Makefile":     false,
+		"x.CMakeLists.txt":   false,
+	} {
+		if _, err := registry.ForPath(path); (err == nil) != want {
+			t.Errorf("got error %v for %s, want found = %t", err, path, want)
+		}
+	}
+}
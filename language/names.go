@@ -0,0 +1,191 @@
+package language
+
+import (
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// Aliases maps common names of languages, as used in Markdown info strings,
+// heredoc delimiters and editor modelines, to the names of their tree-sitter
+// grammars. File extensions are included, since they are often used as
+// names too.
+var Aliases = map[string]string{
+	"js":            "javascript",
+	"jsx":           "javascript",
+	"mjs":           "javascript",
+	"cjs":           "javascript",
+	"node":          "javascript",
+	"nodejs":        "javascript",
+	"ecmascript":    "javascript",
+	"ts":            "typescript",
+	"mts":           "typescript",
+	"cts":           "typescript",
+	"py":            "python",
+	"py2":           "python",
+	"py3":           "python",
+	"python2":       "python",
+	"python3":       "python",
+	"pyw":           "python",
+	"gyp":           "python",
+	"rb":            "ruby",
+	"rs":            "rust",
+	"golang":        "go",
+	"sh":            "bash",
+	"shell":         "bash",
+	"shellscript":   "bash",
+	"ksh":           "bash",
+	"zsh":           "bash",
+	"h":             "c",
+	"c++":           "cpp",
+	"cc":            "cpp",
+	"cxx":           "cpp",
+	"hh":            "cpp",
+	"hpp":           "cpp",
+	"hxx":           "cpp",
+	"cs":            "c_sharp",
+	"c#":            "c_sharp",
+	"csharp":        "c_sharp",
+	"objective-c":   "objc",
+	"objectivec":    "objc",
+	"kt":            "kotlin",
+	"kts":           "kotlin",
+	"hs":            "haskell",
+	"ex":            "elixir",
+	"exs":           "elixir",
+	"erl":           "erlang",
+	"ml":            "ocaml",
+	"jl":            "julia",
+	"pl":            "perl",
+	"pm":            "perl",
+	"clj":           "clojure",
+	"scm":           "scheme",
+	"emacs-lisp":    "elisp",
+	"vimscript":     "vim",
+	"viml":          "vim",
+	"ps1":           "powershell",
+	"pwsh":          "powershell",
+	"posh":          "powershell",
+	"htm":           "html",
+	"xhtml":         "html",
+	"svg":           "xml",
+	"yml":           "yaml",
+	"md":            "markdown",
+	"mkd":           "markdown",
+	"tex":           "latex",
+	"makefile":      "make",
+	"mk":            "make",
+	"docker":        "dockerfile",
+	"containerfile": "dockerfile",
+	"tf":            "hcl",
+	"terraform":     "hcl",
+	"gql":           "graphql",
+	"protobuf":      "proto",
+	"patch":         "diff",
+	"udiff":         "diff",
+	"psql":          "sql",
+	"mysql":         "sql",
+	"postgresql":    "sql",
+}
+
+// MIMETypes maps MIME types, as used in `<script type="...">` and `<style
+// type="...">` attributes, to the names of tree-sitter grammars, or to ""
+// for plain text. MIME types that aren't listed are mapped by their subtype,
+// so `text/x-lua` is `lua` and `application/ld+json` is `json`.
+var MIMETypes = map[string]string{
+	"module":                    "javascript",
+	"text/javascript":           "javascript",
+	"text/ecmascript":           "javascript",
+	"text/babel":                "javascript",
+	"text/jsx":                  "javascript",
+	"application/javascript":    "javascript",
+	"application/x-javascript":  "javascript",
+	"application/ecmascript":    "javascript",
+	"importmap":                 "json",
+	"speculationrules":          "json",
+	"text/x-python":             "python",
+	"text/x-python3":            "python",
+	"application/x-python-code": "python",
+	"text/x-sh":                 "bash",
+	"text/x-shellscript":        "bash",
+	"application/x-sh":          "bash",
+	"text/x-c":                  "c",
+	"text/x-csrc":               "c",
+	"text/x-c++src":             "cpp",
+	"text/x-csharp":             "c_sharp",
+	"text/plain":                "",
+}
+
+// NormalizeName returns the name of the tree-sitter grammar for a free-form
+// language name, like a Markdown info string (`{.python}`, `js title="x"`),
+// a MIME type (`text/x-python; charset=utf-8`) or a versioned name
+// (`python3.12`), using the [Aliases] and [MIMETypes] tables. Names that
+// aren't in the tables are returned cleaned up and in lower case.
+func NormalizeName(name string) string {
+	name = cleanName(name)
+	for n := name; n != ""; {
+		if canonical, ok := MIMETypes[n]; ok {
+			return canonical
+		}
+		if canonical, ok := Aliases[n]; ok {
+			return canonical
+		}
+		if _, subtype, ok := strings.Cut(n, "/"); ok {
+			return mimeSubtype(subtype)
+		}
+
+		trimmed := trimVersion(n)
+		if trimmed == n {
+			break
+		}
+		n = trimmed
+	}
+	return name
+}
+
+// NormalizedInjectionCallback returns an [types.InjectionCallback] that tries
+// the name of the language of an injection as it is first, and then the name
+// from [NormalizeName].
+func NormalizedInjectionCallback(callback types.InjectionCallback) types.InjectionCallback {
+	return func(languageName string) *types.Configuration {
+		if config := callback(languageName); config != nil {
+			return config
+		}
+		if name := NormalizeName(languageName); name != "" && name != languageName {
+			return callback(name)
+		}
+		return nil
+	}
+}
+
+// cleanName removes what surrounds the language in an info string or a MIME
+// type: braces and dots of attributes, further words and attributes, MIME
+// parameters and `language-` class prefixes.
+func cleanName(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.TrimPrefix(name, "{")
+	if i := strings.IndexAny(name, " \t,;}"); i != -1 {
+		name = name[:i]
+	}
+	name = strings.ToLower(strings.TrimPrefix(name, "."))
+	for _, prefix := range []string{"language-", "lang-"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return name
+}
+
+// mimeSubtype returns the name of the grammar for the subtype of a MIME type
+// that isn't in [MIMETypes].
+func mimeSubtype(subtype string) string {
+	switch {
+	case strings.HasSuffix(subtype, "+json"):
+		return "json"
+	case strings.HasSuffix(subtype, "+xml"):
+		return "xml"
+	}
+	subtype = strings.TrimPrefix(subtype, "x-")
+	if canonical, ok := Aliases[subtype]; ok {
+		return canonical
+	}
+	return subtype
+}
@@ -0,0 +1,129 @@
+package language_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/language"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "python", want: "python"},
+		{name: "Python", want: "python"},
+		{name: " py ", want: "python"},
+		{name: "{.python}", want: "python"},
+		{name: "{.python .numberLines startFrom=10}", want: "python"},
+		{name: "js title=\"x\"", want: "javascript"},
+		{name: "js,linenos", want: "javascript"},
+		{name: "language-rust", want: "rust"},
+		{name: "lang-ts", want: "typescript"},
+		{name: "c++", want: "cpp"},
+		{name: "text/x-python; charset=utf-8", want: "python"},
+		{name: "text/javascript", want: "javascript"},
+		{name: "module", want: "javascript"},
+		{name: "application/ld+json", want: "json"},
+		{name: "image/svg+xml", want: "xml"},
+		{name: "text/x-lua", want: "lua"},
+		{name: "text/x-sh", want: "bash"},
+		{name: "text/plain", want: ""},
+		{name: "python3.12", want: "python"},
+		{name: "python3", want: "python"},
+		{name: "unknown", want: "unknown"},
+		{name: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := language.NormalizeName(tt.name); got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizedInjectionCallback(t *testing.T) {
+	configs := map[string]*types.Configuration{
+		"python": {LanguageName: "python"},
+		"json":   {LanguageName: "json"},
+		// A language that is registered by a name that NormalizeName changes.
+		"py": {LanguageName: "py"},
+	}
+	var lookups []string
+	callback := language.NormalizedInjectionCallback(func(languageName string) *types.Configuration {
+		lookups = append(lookups, languageName)
+		return configs[languageName]
+	})
+
+	tests := []struct {
+		name        string
+		want        string
+		wantLookups int
+	}{
+		{name: "python", want: "python", wantLookups: 1},
+		{name: "py", want: "py", wantLookups: 1},
+		{name: "{.python}", want: "python", wantLookups: 2},
+		{name: "text/x-python; charset=utf-8", want: "python", wantLookups: 2},
+		{name: "application/ld+json", want: "json", wantLookups: 2},
+		{name: "python3.12", want: "python", wantLookups: 2},
+		{name: "ruby", want: "", wantLookups: 1},
+		{name: "text/plain", want: "", wantLookups: 1},
+	}
+	for _, tt := range tests {
+		lookups = nil
+		var got string
+		if cfg := callback(tt.name); cfg != nil {
+			got = cfg.LanguageName
+		}
+		if got != tt.want || len(lookups) != tt.wantLookups {
+			t.Errorf("got %q after looking up %q for %q, want %q after %d lookups", got, lookups, tt.name, tt.want, tt.wantLookups)
+		}
+	}
+}
+
+func TestRegistryDetectLanguage(t *testing.T) {
+	registry := language.NewRegistry(testlang.Names)
+	registry.Register(language.Entry{
+		Language: testlang.Language("python"),
+		Shebangs: []string{"python"},
+	})
+	registry.Register(language.Entry{
+		Language:  testlang.Language("html"),
+		Aliases:   []string{"htm"},
+		FirstLine: regexp.MustCompile(`(?i)^<!doctype html`),
+	})
+	registry.Register(language.Entry{
+		Language:  testlang.Language("json"),
+		MIMETypes: []string{"application/manifest+json"},
+	})
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "shebang", content: "#!/usr/bin/python\nx = 1\n", want: "python"},
+		{name: "env shebang", content: "#!/usr/bin/env python3\nx = 1\n", want: "python"},
+		{name: "env shebang with flags", content: "#!/usr/bin/env -S PYTHONPATH=. python3 -u\n", want: "python"},
+		{name: "versioned shebang", content: "#!/usr/local/bin/python3.12\n", want: "python"},
+		{name: "unknown shebang", content: "#!/bin/sh\n", want: ""},
+		{name: "vim modeline", content: "x = 1\n# vim: set ft=python:\n", want: "python"},
+		{name: "vim modeline at the end", content: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n// vim: ft=json\n", want: "json"},
+		{name: "vim modeline in the middle", content: "1\n2\n3\n4\n5\n// vim: ft=json\n7\n8\n9\n10\n11\n", want: ""},
+		{name: "emacs modeline", content: "# -*- mode: python; coding: utf-8 -*-\n", want: "python"},
+		{name: "emacs modeline after shebang", content: "#!/bin/sh\n# -*- python -*-\n", want: "python"},
+		{name: "modeline with alias", content: "<!-- vim: ft=htm -->\n", want: "html"},
+		{name: "first line", content: "<!DOCTYPE html>\n<html></html>\n", want: "html"},
+		{name: "nothing", content: "x = 1\n", want: ""},
+		{name: "empty", content: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.DetectLanguage([]byte(tt.content)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
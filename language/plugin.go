@@ -0,0 +1,142 @@
+package language
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+)
+
+// sharedLibraryExt is the file extension of shared libraries on this platform.
+var sharedLibraryExt = func() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return ".dylib"
+	case "windows":
+		return ".dll"
+	default:
+		return ".so"
+	}
+}()
+
+// LoadLibrary loads a language from a compiled grammar with [OpenLibrary],
+// and its queries from a directory laid out like nvim-treesitter, see
+// [LoadQueryDir].
+func LoadLibrary(path string, name string, queriesDir string) (Language, error) {
+	ptr, err := OpenLibrary(path, name)
+	if err != nil {
+		return Language{}, err
+	}
+	return LoadQueryDir(queriesDir, name, ptr)
+}
+
+// LoadPluginDir loads all languages in a plugin directory, so languages can
+// be added without rebuilding the program. The directory can contain:
+//
+//   - `grammars/<name>/`: grammar repositories with a `tree-sitter.json`
+//     file, see [LoadGrammarDir], and a compiled parser named `<name>.so`,
+//     `libtree-sitter-<name>.so` or `parser.so`,
+//   - `parsers/<name>.so` or `parsers/libtree-sitter-<name>.so`: compiled
+//     parsers, with their queries in `queries/<name>/`, see [LoadLibrary],
+//   - `parsers/tree-sitter.json`: the metadata of the compiled parsers, in
+//     the format of grammar repositories. The `file-types`, `scope`,
+//     `injection-regex` and `first-line-regex` of the grammar with the name
+//     of a parser are used for it, like in [LoadGrammarDir].
+//
+// Shared libraries have the extension of the platform, like `.dylib` on
+// macOS. Missing directories and files are skipped. Queries in `queries/` can
+// also be inherited by the queries of the grammar repositories. Languages
+// from `parsers/` without metadata have no file types, and are only found by
+// name.
+func LoadPluginDir(dir string) ([]Entry, error) {
+	var result []Entry
+	queriesDir := filepath.Join(dir, "queries")
+
+	grammars, err := os.ReadDir(filepath.Join(dir, "grammars"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading grammars: %w", err)
+	}
+	for _, grammar := range grammars {
+		grammarDir := filepath.Join(dir, "grammars", grammar.Name())
+		var openErr error
+		entries, err := LoadGrammarDir(grammarDir, func(name string) unsafe.Pointer {
+			ptr, err := OpenLibrary(findParser(grammarDir, name), name)
+			if err != nil && openErr == nil {
+				openErr = err
+			}
+			return ptr
+		}, queriesDir)
+		if openErr != nil {
+			return nil, openErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %w", grammarDir, err)
+		}
+		result = append(result, entries...)
+	}
+
+	parsers, err := os.ReadDir(filepath.Join(dir, "parsers"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error reading parsers: %w", err)
+	}
+	metadata, err := readParserMetadata(filepath.Join(dir, "parsers"))
+	if err != nil {
+		return nil, err
+	}
+	for _, parser := range parsers {
+		name, ok := strings.CutSuffix(parser.Name(), sharedLibraryExt)
+		if !ok {
+			continue
+		}
+		name = strings.TrimPrefix(name, "libtree-sitter-")
+
+		lang, err := LoadLibrary(filepath.Join(dir, "parsers", parser.Name()), name, queriesDir)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := metadata[name].entry(lang)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+// readParserMetadata returns the grammars of the `tree-sitter.json` file in
+// the parsers directory by name, or none if there is no such file.
+func readParserMetadata(dir string) (map[string]grammarConfig, error) {
+	grammars, err := readGrammarConfigs(filepath.Join(dir, "tree-sitter.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", dir, err)
+	}
+
+	metadata := make(map[string]grammarConfig, len(grammars))
+	for _, grammar := range grammars {
+		metadata[grammar.Name] = grammar
+	}
+	return metadata, nil
+}
+
+// findParser returns the path of the compiled parser in a grammar directory.
+func findParser(dir string, name string) string {
+	for _, candidate := range []string{
+		name + sharedLibraryExt,
+		"libtree-sitter-" + name + sharedLibraryExt,
+		"parser" + sharedLibraryExt,
+	} {
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, name+sharedLibraryExt)
+}
@@ -0,0 +1,105 @@
+package language
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadParserMetadata(t *testing.T) {
+	dir := t.TempDir()
+	data := `{
+  "grammars": [
+    { "name": "python", "scope": "source.python", "file-types": ["py", "pyw", "SConstruct"] },
+    { "name": "json", "injection-regex": "^json$" }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(dir, "tree-sitter.json"), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := readParserMetadata(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		wantExtensions []string
+		wantFilenames  []string
+		wantScope      string
+		wantInjection  bool
+	}{
+		{name: "python", wantExtensions: []string{"py", "pyw"}, wantFilenames: []string{"SConstruct"}, wantScope: "source.python"},
+		{name: "json", wantInjection: true},
+		// Parsers without metadata have no file types, not even their name
+		// or aliases like "node".
+		{name: "javascript"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := metadata[tt.name].entry(Language{Name: tt.name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Language.Name != tt.name {
+				t.Errorf("got language %s, want %s", entry.Language.Name, tt.name)
+			}
+			if !slices.Equal(entry.Extensions, tt.wantExtensions) {
+				t.Errorf("got extensions %q, want %q", entry.Extensions, tt.wantExtensions)
+			}
+			if !slices.Equal(entry.Filenames, tt.wantFilenames) {
+				t.Errorf("got filenames %q, want %q", entry.Filenames, tt.wantFilenames)
+			}
+			if entry.Scope != tt.wantScope {
+				t.Errorf("got scope %q, want %q", entry.Scope, tt.wantScope)
+			}
+			if (entry.InjectionRegex != nil) != tt.wantInjection {
+				t.Errorf("got injection regex %v, want one: %t", entry.InjectionRegex, tt.wantInjection)
+			}
+		})
+	}
+}
+
+func TestReadParserMetadataErrors(t *testing.T) {
+	// A missing file is no metadata.
+	if metadata, err := readParserMetadata(t.TempDir()); metadata != nil || err != nil {
+		t.Errorf("got %v, %v, want no metadata", metadata, err)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tree-sitter.json"), []byte(`{"grammars": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readParserMetadata(dir); err == nil || !strings.Contains(err.Error(), "error parsing tree-sitter.json") {
+		t.Errorf("got error %v, want a parse error", err)
+	}
+}
+
+func TestLoadPluginDirMissingSymbol(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs a shared library without the language function")
+	}
+
+	// libc can be opened, but has no language function, so the library is
+	// closed again.
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "parsers"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	libc, err := filepath.Glob("/usr/lib/*/libc.so.6")
+	if err != nil || len(libc) == 0 {
+		t.Skip("libc.so.6 not found")
+	}
+	if err := os.Symlink(libc[0], filepath.Join(dir, "parsers", "python.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadPluginDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "error finding tree_sitter_python in") {
+		t.Errorf("got error %v, want a missing symbol error", err)
+	}
+}
@@ -0,0 +1,472 @@
+package language
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/config"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// ErrUnknownLanguage is returned when no registered language matches a lookup.
+var ErrUnknownLanguage = errors.New("unknown language")
+
+// Entry describes a language in a [Registry], and how to detect it.
+type Entry struct {
+	Language Language
+	// Scope is the TextMate scope of the language, e.g. "source.js". The
+	// language can also be found by its scope.
+	Scope string
+	// Aliases are other names the language can be found by, e.g. "js" for "javascript".
+	Aliases []string
+	// InjectionRegex matches other names the language can be found by, if
+	// none of the languages match by name, alias or scope.
+	InjectionRegex *regexp.Regexp
+	// MIMETypes are media types the language can be found by in injections,
+	// e.g. "text/javascript", in addition to the ones in [MIMETypes].
+	MIMETypes []string
+	// Extensions are file extensions without the leading dot, e.g. "go" or "d.ts".
+	Extensions []string
+	// Filenames are glob patterns, as used by [path.Match], that are matched
+	// against the base name of a file, e.g. "Makefile" or "*.mk".
+	Filenames []string
+	// Shebangs are interpreter names used in a `#!` line, e.g. "python3" or "node".
+	Shebangs []string
+	// FirstLine is matched against the first line of the content, e.g. `^<\?php`.
+	FirstLine *regexp.Regexp
+}
+
+type registryEntry struct {
+	Entry
+
+	mu sync.Mutex
+	// base is the configuration created from the queries, without settings.
+	base *types.Configuration
+	err  error
+	// config is base with settings applied.
+	config   *types.Configuration
+	settings *registrySettings
+}
+
+// registrySettings are applied to the configurations of all languages in a
+// registry. They are replaced instead of changed, so that configurations
+// which are already in use never change.
+type registrySettings struct {
+	predicates map[string]types.Predicate
+	directives map[string]types.Directive
+	detector   types.InjectionDetector
+}
+
+// Registry holds languages and looks them up by name, file path or content.
+// The highlight configurations of the languages are created when they are
+// first needed and then cached. A Registry is safe for concurrent use.
+type Registry struct {
+	recognisedNames []string
+
+	mu       sync.Mutex
+	entries  []*registryEntry
+	settings *registrySettings
+}
+
+// NewRegistry creates an empty Registry. The recognised names are used to
+// create the configurations of all languages in the registry.
+func NewRegistry(recognisedNames []string) *Registry {
+	return &Registry{
+		recognisedNames: recognisedNames,
+		settings:        &registrySettings{},
+	}
+}
+
+// Register adds a language to the registry. Languages registered later take
+// precedence over earlier ones when both match a lookup.
+func (r *Registry) Register(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, &registryEntry{Entry: entry})
+}
+
+// RegisterPredicate registers a custom query predicate on the configurations of all languages in
+// the registry, like [types.Configuration.RegisterPredicate]. Configurations that were returned
+// before don't change, so it should be called before the registry is used.
+func (r *Registry) RegisterPredicate(name string, predicate types.Predicate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	settings := *r.settings
+	settings.predicates = maps.Clone(settings.predicates)
+	if settings.predicates == nil {
+		settings.predicates = make(map[string]types.Predicate)
+	}
+	settings.predicates[name] = predicate
+	r.settings = &settings
+}
+
+// RegisterDirective registers a custom query directive on the configurations of all languages in
+// the registry, like [types.Configuration.RegisterDirective]. Configurations that were returned
+// before don't change, so it should be called before the registry is used.
+func (r *Registry) RegisterDirective(name string, directive types.Directive) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	settings := *r.settings
+	settings.directives = maps.Clone(settings.directives)
+	if settings.directives == nil {
+		settings.directives = make(map[string]types.Directive)
+	}
+	settings.directives[name] = directive
+	r.settings = &settings
+}
+
+// SetInjectionDetector sets the [types.InjectionDetector] of the configurations of all languages in
+// the registry, which finds the language of injections whose language isn't captured or set. Use
+// [Registry.DetectLanguage] to detect languages by their content. Configurations that were returned
+// before don't change, so it should be called before the registry is used.
+func (r *Registry) SetInjectionDetector(detector types.InjectionDetector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	settings := *r.settings
+	settings.detector = detector
+	r.settings = &settings
+}
+
+// Names returns the names of all registered languages.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, len(r.entries))
+	for i, entry := range r.entries {
+		names[i] = entry.Language.Name
+	}
+	return names
+}
+
+// ForName returns the configuration for the language with the given name,
+// alias or scope. Names are matched case-insensitively. If no language
+// matches, the injection regexes of the languages are tried.
+func (r *Registry) ForName(name string) (*types.Configuration, error) {
+	config, err := r.find(name, func(entry *registryEntry) bool {
+		if strings.EqualFold(entry.Language.Name, name) || entry.Scope != "" && strings.EqualFold(entry.Scope, name) {
+			return true
+		}
+		for _, alias := range entry.Aliases {
+			if strings.EqualFold(alias, name) {
+				return true
+			}
+		}
+		return false
+	})
+	if !errors.Is(err, ErrUnknownLanguage) {
+		return config, err
+	}
+
+	return r.find(name, func(entry *registryEntry) bool {
+		return entry.InjectionRegex != nil && entry.InjectionRegex.MatchString(name)
+	})
+}
+
+// ForInjection returns the configuration for a free-form language name, like
+// the info string of a Markdown code block, a heredoc delimiter or the type
+// of a `<script>` element. The name is tried as it is with [Registry.ForName],
+// then as a MIME type, then as normalized by [NormalizeName], and finally as a
+// file extension.
+func (r *Registry) ForInjection(name string) (*types.Configuration, error) {
+	config, err := r.ForName(name)
+	if !errors.Is(err, ErrUnknownLanguage) {
+		return config, err
+	}
+
+	cleaned := cleanName(name)
+	if cleaned == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLanguage, name)
+	}
+	config, err = r.find(name, func(entry *registryEntry) bool {
+		for _, mimeType := range entry.MIMETypes {
+			if strings.EqualFold(mimeType, cleaned) {
+				return true
+			}
+		}
+		return false
+	})
+	if !errors.Is(err, ErrUnknownLanguage) {
+		return config, err
+	}
+
+	if normalized := NormalizeName(name); normalized != "" && normalized != name {
+		config, err := r.ForName(normalized)
+		if !errors.Is(err, ErrUnknownLanguage) {
+			return config, err
+		}
+	}
+
+	if !strings.ContainsAny(cleaned, "/.") {
+		config, err := r.ForPath("file." + cleaned)
+		if !errors.Is(err, ErrUnknownLanguage) {
+			return config, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownLanguage, name)
+}
+
+// ForPath returns the configuration for the language of the file at the
+// given path. Filename patterns are checked first, then file extensions,
+// with longer extensions (e.g. "d.ts") taking precedence over shorter ones.
+func (r *Registry) ForPath(filePath string) (*types.Configuration, error) {
+	base := filepath.Base(filePath)
+
+	config, err := r.find(filePath, func(entry *registryEntry) bool {
+		for _, pattern := range entry.Filenames {
+			if ok, _ := path.Match(pattern, base); ok {
+				return true
+			}
+		}
+		return false
+	})
+	if !errors.Is(err, ErrUnknownLanguage) {
+		return config, err
+	}
+
+	for ext := range extensions(base) {
+		config, err := r.find(filePath, func(entry *registryEntry) bool {
+			for _, e := range entry.Extensions {
+				if strings.EqualFold(e, ext) {
+					return true
+				}
+			}
+			return false
+		})
+		if !errors.Is(err, ErrUnknownLanguage) {
+			return config, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownLanguage, filePath)
+}
+
+// ForContent returns the configuration for the language of the given content,
+// based on the interpreter in its `#!` line, a Vim or Emacs modeline like
+// `vim: ft=python` or `-*- mode: python -*-`, or the patterns matched against
+// its first line.
+func (r *Registry) ForContent(content []byte) (*types.Configuration, error) {
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	firstLine = bytes.TrimSuffix(firstLine, []byte("\r"))
+
+	if interpreter := shebangInterpreter(string(firstLine)); interpreter != "" {
+		// Try the exact interpreter first, then without a version suffix, so
+		// that "python3.12" finds a language registered for "python3" or "python".
+		for name := interpreter; name != ""; name = trimVersion(name) {
+			config, err := r.find(name, func(entry *registryEntry) bool {
+				for _, shebang := range entry.Shebangs {
+					if shebang == name {
+						return true
+					}
+				}
+				return false
+			})
+			if !errors.Is(err, ErrUnknownLanguage) {
+				return config, err
+			}
+			if trimVersion(name) == name {
+				break
+			}
+		}
+	}
+
+	if name := modelineLanguage(content); name != "" {
+		config, err := r.ForInjection(name)
+		if !errors.Is(err, ErrUnknownLanguage) {
+			return config, err
+		}
+	}
+
+	return r.find("content", func(entry *registryEntry) bool {
+		return entry.FirstLine != nil && entry.FirstLine.Match(firstLine)
+	})
+}
+
+// DetectLanguage returns the name of the language of the given content, as
+// found by [Registry.ForContent], or "" if there is none. It can be used as a
+// [types.InjectionDetector].
+func (r *Registry) DetectLanguage(content []byte) string {
+	config, err := r.ForContent(content)
+	if err != nil {
+		return ""
+	}
+	return config.LanguageName
+}
+
+// InjectionCallback returns an [types.InjectionCallback] that finds injected
+// languages in the registry with [Registry.ForInjection].
+func (r *Registry) InjectionCallback() types.InjectionCallback {
+	return func(languageName string) *types.Configuration {
+		config, err := r.ForInjection(languageName)
+		if err != nil {
+			return nil
+		}
+		return config
+	}
+}
+
+// find returns the configuration of the last registered entry that matches.
+func (r *Registry) find(query string, match func(entry *registryEntry) bool) (*types.Configuration, error) {
+	r.mu.Lock()
+	var found *registryEntry
+	for _, entry := range slices.Backward(r.entries) {
+		if match(entry) {
+			found = entry
+			break
+		}
+	}
+	settings := r.settings
+	r.mu.Unlock()
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLanguage, query)
+	}
+	return found.configuration(r.recognisedNames, settings)
+}
+
+// configuration returns the configuration of the entry with the settings
+// applied. The queries are only compiled once, and not while the registry is
+// locked, so that lookups of other languages don't wait for them.
+func (e *registryEntry) configuration(recognisedNames []string, settings *registrySettings) (*types.Configuration, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.base == nil && e.err == nil {
+		lang := e.Language
+		e.base, e.err = config.New(lang.Lang, lang.Name, lang.HighlightsQuery, lang.InjectionQuery, lang.LocalsQuery, recognisedNames)
+		if e.err != nil {
+			e.err = fmt.Errorf("error creating configuration for %s: %w", lang.Name, e.err)
+		}
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	if e.config == nil || e.settings != settings {
+		cfg := *e.base
+		cfg.Predicates = maps.Clone(settings.predicates)
+		cfg.Directives = maps.Clone(settings.directives)
+		cfg.InjectionDetector = settings.detector
+		e.config = &cfg
+		e.settings = settings
+	}
+	return e.config, nil
+}
+
+// extensions yields all extensions of a file name, longest first. For
+// "foo.d.ts" these are "d.ts" and "ts".
+func extensions(base string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		// Skip a leading dot, so ".bashrc" has no extension.
+		name := strings.TrimPrefix(base, ".")
+		for {
+			i := strings.IndexByte(name, '.')
+			if i == -1 {
+				return
+			}
+			name = name[i+1:]
+			if !yield(name) {
+				return
+			}
+		}
+	}
+}
+
+// shebangInterpreter returns the interpreter of a `#!` line, looking through
+// `/usr/bin/env` and its flags.
+func shebangInterpreter(line string) string {
+	line, ok := strings.CutPrefix(line, "#!")
+	if !ok {
+		return ""
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			// Skip flags like `-S` and variable assignments like `FOO=bar`.
+			if strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+				continue
+			}
+			interpreter = path.Base(field)
+			break
+		}
+	}
+	return interpreter
+}
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vim?(?:[<=>]?\d+)?|ex):.*?\b(?:ft|filetype|syntax|syn)=([\w+#-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-(.*?)-\*-`)
+	emacsMode     = regexp.MustCompile(`(?i)(?:^|;)\s*mode\s*:\s*([\w+#-]+)`)
+)
+
+// modelineLanguage returns the language of a Vim modeline in the first or
+// last five lines of the content, or of an Emacs modeline in its first line,
+// or its second line after a `#!` line.
+func modelineLanguage(content []byte) string {
+	// Only the first and last five lines are needed, so don't split all of a large file.
+	var lines []string
+	rest := string(content)
+	for i := 0; i < 5 && rest != ""; i++ {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		lines = append(lines, line)
+	}
+	for i := 0; i < 5 && rest != ""; i++ {
+		j := strings.LastIndexByte(rest, '\n')
+		lines = append(lines, rest[j+1:])
+		rest = rest[:max(j, 0)]
+	}
+
+	for _, line := range lines {
+		if m := vimModeline.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+
+	for i, line := range lines[:min(2, len(lines))] {
+		if i == 1 && !strings.HasPrefix(lines[0], "#!") {
+			break
+		}
+		m := emacsModeline.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if !strings.Contains(m[1], ":") {
+			return strings.TrimSpace(m[1])
+		}
+		if mode := emacsMode.FindStringSubmatch(m[1]); mode != nil {
+			return mode[1]
+		}
+	}
+	return ""
+}
+
+// trimVersion removes a trailing version from an interpreter name, e.g.
+// "python3.12" becomes "python3", and "python3" becomes "python".
+func trimVersion(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i != -1 {
+		return name[:i]
+	}
+	return strings.TrimRight(name, "0123456789")
+}
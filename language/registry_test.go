@@ -0,0 +1,83 @@
+package language_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/language"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+func newRegistry() *language.Registry {
+	registry := language.NewRegistry(testlang.Names)
+	registry.Register(language.Entry{Language: testlang.Language("python"), Extensions: []string{"py"}})
+	registry.Register(language.Entry{Language: testlang.Language("json"), Extensions: []string{"json"}})
+	return registry
+}
+
+func TestRegistryConcurrentLookups(t *testing.T) {
+	registry := newRegistry()
+
+	var wg sync.WaitGroup
+	configs := make([]*types.Configuration, 16)
+	for i := range configs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := "python"
+			if i%2 == 1 {
+				name = "json"
+			}
+			cfg, err := registry.ForName(name)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			configs[i] = cfg
+		}()
+	}
+	wg.Wait()
+
+	for i, cfg := range configs {
+		if cfg != configs[i%2] {
+			t.Errorf("lookup %d returned another configuration than lookup %d", i, i%2)
+		}
+	}
+}
+
+func TestRegistrySettingsDontChangeConfigurations(t *testing.T) {
+	registry := newRegistry()
+
+	before, err := registry.ForName("python")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicate := func(call types.PredicateCall) bool { return true }
+	directive := func(call types.PredicateCall, metadata *types.MatchMetadata) {}
+	registry.RegisterPredicate("test?", predicate)
+	registry.RegisterDirective("test!", directive)
+	registry.SetInjectionDetector(func(content []byte) string { return "python" })
+
+	if before.Predicates != nil || before.Directives != nil || before.InjectionDetector != nil {
+		t.Error("settings changed a configuration that was already returned")
+	}
+
+	after, err := registry.ForName("python")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Predicates["test?"] == nil || after.Directives["test!"] == nil || after.InjectionDetector == nil {
+		t.Error("settings weren't applied to a configuration returned afterwards")
+	}
+	if again, _ := registry.ForName("python"); again != after {
+		t.Error("configuration was created again without new settings")
+	}
+
+	// Configurations don't share the maps of the registry.
+	after.RegisterPredicate("other?", predicate)
+	if again, _ := registry.ForPath("file.json"); again.Predicates["other?"] != nil {
+		t.Error("predicate registered on one configuration is on another one")
+	}
+}
@@ -0,0 +1,43 @@
+package highlight
+
+import (
+	"context"
+	"iter"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/lines"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// SplitLines splits a stream of highlight events, as returned by
+// [HighlightEvents], into source lines. The events of every line are
+// balanced: a line starts with an [EventCaptureStart] for every highlight
+// that is open at its start, each after an [EventLayerStart] for its layer,
+// and ends with the matching end events and an [EventLayerEnd]. The
+// [EventSource] events of a line don't include the line break. A line break
+// at the very end of the source doesn't start a new line. Lines end at `\n`
+// and at a lone `\r`, which [LineEndingsNormalize] writes as a line break.
+func SplitLines(events iter.Seq2[Event, error], source string) iter.Seq2[[]Event, error] {
+	return lines.Split(events, source, LineEndingsNormalize)
+}
+
+// RenderHTMLLines renders a stream of highlight events like [RenderHTML],
+// but returns the HTML of every source line separately, without line breaks.
+// Each line is self-contained, with balanced `<span>` tags, so lines can be
+// put in table rows, diff views or virtualised lists. See [SplitLines].
+func RenderHTMLLines(events iter.Seq2[Event, error], source string, attributeCallback types.AttributeCallback) ([]string, error) {
+	return html.RenderLines(events, source, attributeCallback)
+}
+
+// HighlightLines highlights the given source code and returns the HTML of
+// every line separately. See [RenderHTMLLines].
+func HighlightLines(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) ([]string, error) {
+	return defaultHighlighter.HighlightLines(ctx, cfg, source, injectionCallback, attributeCallback)
+}
+
+// HighlightLines highlights the given source code and returns the HTML of
+// every line separately. See [RenderHTMLLines].
+func (h *Highlighter) HighlightLines(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback) ([]string, error) {
+	events := h.HighlightEvents(ctx, cfg, source, injectionCallback)
+	return html.RenderLines(events, source, attributeCallback)
+}
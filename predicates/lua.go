@@ -0,0 +1,198 @@
+package predicates
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// luaClasses are the POSIX classes of Go regular expressions for the
+// character classes of Lua patterns, like `%a`. Upper case classes like
+// `%A` are their complements.
+var luaClasses = map[byte]string{
+	'a': "alpha",
+	'c': "cntrl",
+	'd': "digit",
+	'g': "graph",
+	'l': "lower",
+	'p': "punct",
+	's': "space",
+	'u': "upper",
+	'w': "alnum",
+	'x': "xdigit",
+}
+
+// luaPatterns caches the regular expressions of Lua patterns, since queries
+// use the same patterns for many matches.
+var luaPatterns sync.Map
+
+// luaRegexp compiles a Lua pattern, as used by `#lua-match?` and `#gsub!`,
+// to a regular expression. Balanced matches (`%b`), frontier patterns (`%f`)
+// and back references aren't supported.
+func luaRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := luaPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	expr, err := translateLuaPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling Lua pattern %q: %w", pattern, err)
+	}
+	luaPatterns.Store(pattern, re)
+	return re, nil
+}
+
+func translateLuaPattern(pattern string) (string, error) {
+	var b strings.Builder
+	// Unlike in regular expressions, `.` matches line breaks in Lua patterns.
+	b.WriteString("(?s)")
+
+	// repeatable is whether the last item is a single character class, which
+	// a quantifier can follow. Quantifiers without one match themselves.
+	repeatable := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '^' && i == 0:
+			b.WriteByte('^')
+			repeatable = false
+		case c == '$' && i == len(pattern)-1:
+			b.WriteByte('$')
+			repeatable = false
+		case c == '%':
+			i++
+			if i == len(pattern) {
+				return "", fmt.Errorf("error in Lua pattern %q: pattern ends with %%", pattern)
+			}
+			class, err := luaEscape(pattern, pattern[i], false)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+			repeatable = true
+		case c == '[':
+			end, err := translateLuaSet(&b, pattern, i)
+			if err != nil {
+				return "", err
+			}
+			i = end
+			repeatable = true
+		case (c == '-' || c == '*' || c == '+' || c == '?') && !repeatable:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+			repeatable = true
+		case c == '-':
+			// `-` is the lazy version of `*`.
+			b.WriteString("*?")
+			repeatable = false
+		case c == '*' || c == '+' || c == '?':
+			b.WriteByte(c)
+			repeatable = false
+		case c == '(' || c == ')':
+			b.WriteByte(c)
+			repeatable = false
+		case c == '.':
+			b.WriteByte(c)
+			repeatable = true
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			repeatable = true
+		}
+	}
+	return b.String(), nil
+}
+
+// translateLuaSet writes the set `[...]` starting at pattern[start], and
+// returns the index of its closing bracket.
+func translateLuaSet(b *strings.Builder, pattern string, start int) (int, error) {
+	b.WriteByte('[')
+	i := start + 1
+	if i < len(pattern) && pattern[i] == '^' {
+		b.WriteByte('^')
+		i++
+	}
+
+	for first := true; i < len(pattern); i, first = i+1, false {
+		c := pattern[i]
+		switch {
+		case c == ']' && !first:
+			b.WriteByte(']')
+			return i, nil
+		case c == '%':
+			i++
+			if i == len(pattern) {
+				return 0, fmt.Errorf("error in Lua pattern %q: pattern ends with %%", pattern)
+			}
+			class, err := luaEscape(pattern, pattern[i], true)
+			if err != nil {
+				return 0, err
+			}
+			b.WriteString(class)
+		case c == '-' && !first && i+1 < len(pattern) && pattern[i+1] != ']':
+			b.WriteByte('-')
+		case c == '\\' || c == '[' || c == ']' || c == '^' || c == '-':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("error in Lua pattern %q: missing ] in set", pattern)
+}
+
+// luaEscape translates the escape `%c`, inside of a set or not.
+func luaEscape(pattern string, c byte, inSet bool) (string, error) {
+	isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	if name, ok := luaClasses[c|0x20]; ok && isLetter {
+		if c >= 'A' && c <= 'Z' {
+			name = "^" + name
+		}
+		if inSet {
+			return "[:" + name + ":]", nil
+		}
+		return "[[:" + name + ":]]", nil
+	}
+
+	switch {
+	case c == 'b' || c == 'f':
+		return "", fmt.Errorf("error in Lua pattern %q: %%%c isn't supported", pattern, c)
+	case c >= '0' && c <= '9':
+		return "", fmt.Errorf("error in Lua pattern %q: back references aren't supported", pattern)
+	case isLetter:
+		return "", fmt.Errorf("error in Lua pattern %q: unknown class %%%c", pattern, c)
+	}
+
+	if inSet {
+		return `\` + string(c), nil
+	}
+	return regexp.QuoteMeta(string(c)), nil
+}
+
+// luaReplacement translates the replacement of `#gsub!`, where `%1` is a
+// capture group and `%%` is a `%`, to the template of
+// [regexp.Regexp.ReplaceAllString].
+func luaReplacement(replacement string) string {
+	var b strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		switch {
+		case c == '$':
+			b.WriteString("$$")
+		case c == '%' && i+1 < len(replacement):
+			i++
+			if d := replacement[i]; d >= '0' && d <= '9' {
+				b.WriteString("${" + string(d) + "}")
+			} else {
+				b.WriteByte(d)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
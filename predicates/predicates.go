@@ -0,0 +1,242 @@
+// Package predicates implements the custom query predicates and directives
+// of nvim-treesitter query files, like `#lua-match?` and `#offset!`, so that
+// they can be registered on a configuration.
+package predicates
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// Predicates are the predicates of nvim-treesitter query files, by name. The
+// negated versions, like `not-has-parent?`, work without registering them.
+var Predicates = map[string]types.Predicate{
+	"lua-match?":    LuaMatch,
+	"has-parent?":   HasParent,
+	"has-ancestor?": HasAncestor,
+	"contains?":     Contains,
+}
+
+// Directives are the directives of nvim-treesitter query files, by name.
+var Directives = map[string]types.Directive{
+	"offset!":                    Offset,
+	"gsub!":                      Gsub,
+	"trim!":                      Trim,
+	"set-lang-from-info-string!": SetLangFromInfoString,
+}
+
+// Register registers all [Predicates] and [Directives] on a configuration.
+func Register(config *types.Configuration) {
+	for name, predicate := range Predicates {
+		config.RegisterPredicate(name, predicate)
+	}
+	for name, directive := range Directives {
+		config.RegisterDirective(name, directive)
+	}
+}
+
+// all reports whether the nodes of the first argument, which must be a
+// capture, all satisfy f.
+func all(call types.PredicateCall, f func(node tree_sitter.Node) bool) bool {
+	if _, ok := call.Capture(0); !ok {
+		return false
+	}
+	for _, node := range call.Nodes(0) {
+		if !f(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// LuaMatch implements `(#lua-match? @capture "pattern")`, which matches the
+// text of the capture against a Lua pattern. Unlike `#match?`, the pattern
+// isn't anchored unless it starts with `^`. Invalid patterns never match.
+func LuaMatch(call types.PredicateCall) bool {
+	pattern, ok := call.String(1)
+	if !ok {
+		return false
+	}
+	re, err := luaRegexp(pattern)
+	if err != nil {
+		return false
+	}
+	return all(call, func(node tree_sitter.Node) bool {
+		return re.MatchString(call.Text(node))
+	})
+}
+
+// HasParent implements `(#has-parent? @capture "kind" ...)`, which checks
+// that the parent of the capture is one of the kinds.
+func HasParent(call types.PredicateCall) bool {
+	kinds := call.Strings(1)
+	return all(call, func(node tree_sitter.Node) bool {
+		parent := node.Parent()
+		return parent != nil && slices.Contains(kinds, parent.Kind())
+	})
+}
+
+// HasAncestor implements `(#has-ancestor? @capture "kind" ...)`, which
+// checks that an ancestor of the capture is one of the kinds.
+func HasAncestor(call types.PredicateCall) bool {
+	kinds := call.Strings(1)
+	return all(call, func(node tree_sitter.Node) bool {
+		for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+			if slices.Contains(kinds, parent.Kind()) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Contains implements `(#contains? @capture "text" ...)`, which checks that
+// the text of the capture contains one of the strings.
+func Contains(call types.PredicateCall) bool {
+	values := call.Strings(1)
+	return all(call, func(node tree_sitter.Node) bool {
+		text := call.Text(node)
+		return slices.ContainsFunc(values, func(value string) bool {
+			return strings.Contains(text, value)
+		})
+	})
+}
+
+// Offset implements `(#offset! @capture startRow startColumn endRow endColumn)`,
+// which moves the start and end of the range of the capture by a number of
+// rows and columns. Columns are in bytes, like the columns of tree-sitter.
+func Offset(call types.PredicateCall, metadata *types.MatchMetadata) {
+	capture, ok := call.Capture(0)
+	nodes := call.Nodes(0)
+	if !ok || len(nodes) == 0 {
+		return
+	}
+
+	var offsets [4]int
+	for i := range offsets {
+		value, _ := call.String(i + 1)
+		offsets[i], _ = strconv.Atoi(value)
+	}
+
+	r := nodes[0].Range()
+	if current, ok := metadata.Ranges[capture]; ok {
+		r = current
+	}
+	start := movePoint(r.StartPoint, offsets[0], offsets[1])
+	end := movePoint(r.EndPoint, offsets[2], offsets[3])
+	if start.Row > end.Row || start.Row == end.Row && start.Column > end.Column {
+		return
+	}
+
+	metadata.SetRange(capture, tree_sitter.Range{
+		StartByte:  byteForPoint(call.Source, r.StartByte, r.StartPoint, start),
+		StartPoint: start,
+		EndByte:    byteForPoint(call.Source, r.EndByte, r.EndPoint, end),
+		EndPoint:   end,
+	})
+}
+
+// Gsub implements `(#gsub! @capture "pattern" "replacement")`, which
+// replaces all matches of a Lua pattern in the text of the capture, like
+// Lua's `string.gsub`. The replacement can refer to groups like `%1`.
+func Gsub(call types.PredicateCall, metadata *types.MatchMetadata) {
+	capture, ok := call.Capture(0)
+	nodes := call.Nodes(0)
+	pattern, hasPattern := call.String(1)
+	replacement, hasReplacement := call.String(2)
+	if !ok || len(nodes) == 0 || !hasPattern || !hasReplacement {
+		return
+	}
+	re, err := luaRegexp(pattern)
+	if err != nil {
+		return
+	}
+
+	text, ok := metadata.Texts[capture]
+	if !ok {
+		text = call.Text(nodes[0])
+	}
+	metadata.SetText(capture, re.ReplaceAllString(text, luaReplacement(replacement)))
+}
+
+// Trim implements `(#trim! @capture)`, which removes the blank lines at the
+// end of the range of the capture.
+func Trim(call types.PredicateCall, metadata *types.MatchMetadata) {
+	capture, ok := call.Capture(0)
+	nodes := call.Nodes(0)
+	if !ok || len(nodes) == 0 {
+		return
+	}
+
+	r := nodes[0].Range()
+	if current, ok := metadata.Ranges[capture]; ok {
+		r = current
+	}
+	end := min(r.EndByte, uint(len(call.Source)))
+	text := call.Source[min(r.StartByte, end):end]
+	trimmed := bytes.TrimRight(text, " \t\r\n")
+	if len(trimmed) == len(text) {
+		return
+	}
+	// Only blank lines are removed, not the whitespace at the end of the last line that isn't blank.
+	if i := bytes.IndexByte(text[len(trimmed):], '\n'); i != -1 {
+		trimmed = bytes.TrimSuffix(text[:len(trimmed)+i], []byte("\r"))
+	}
+
+	r.EndByte = r.StartByte + uint(len(trimmed))
+	r.EndPoint = pointAfter(r.StartPoint, trimmed)
+	metadata.SetRange(capture, r)
+}
+
+// SetLangFromInfoString implements `(#set-lang-from-info-string! @capture)`,
+// which sets the `injection.language` of the match to the text of the
+// capture, the info string of a Markdown code block, in lower case.
+func SetLangFromInfoString(call types.PredicateCall, metadata *types.MatchMetadata) {
+	capture, ok := call.Capture(0)
+	nodes := call.Nodes(0)
+	if !ok || len(nodes) == 0 {
+		return
+	}
+
+	text, ok := metadata.Texts[capture]
+	if !ok {
+		text = call.Text(nodes[0])
+	}
+	if language := strings.ToLower(strings.TrimSpace(text)); language != "" {
+		metadata.Set("injection.language", language)
+	}
+}
+
+func movePoint(point tree_sitter.Point, rows int, columns int) tree_sitter.Point {
+	return tree_sitter.NewPoint(uint(max(int(point.Row)+rows, 0)), uint(max(int(point.Column)+columns, 0)))
+}
+
+// byteForPoint returns the byte offset of the point to, starting from the
+// byte offset of the point from.
+func byteForPoint(source []byte, fromByte uint, from tree_sitter.Point, to tree_sitter.Point) uint {
+	lineStart := fromByte - min(from.Column, fromByte)
+	for row := from.Row; row < to.Row; row++ {
+		i := bytes.IndexByte(source[min(lineStart, uint(len(source))):], '\n')
+		if i == -1 {
+			return uint(len(source))
+		}
+		lineStart += uint(i) + 1
+	}
+	for row := from.Row; row > to.Row && lineStart > 0; row-- {
+		lineStart = uint(bytes.LastIndexByte(source[:lineStart-1], '\n') + 1)
+	}
+	return min(lineStart+to.Column, uint(len(source)))
+}
+
+// pointAfter returns the point after text, which starts at the point start.
+func pointAfter(start tree_sitter.Point, text []byte) tree_sitter.Point {
+	if i := bytes.LastIndexByte(text, '\n'); i != -1 {
+		return tree_sitter.NewPoint(start.Row+uint(bytes.Count(text, []byte("\n"))), uint(len(text)-i-1))
+	}
+	return tree_sitter.NewPoint(start.Row, start.Column+uint(len(text)))
+}
@@ -0,0 +1,270 @@
+package predicates
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"testing"
+
+	highlight "github.com/noclaps/go-tree-sitter-highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/config"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// highlights returns the highlighted texts of the source, as capture names
+// followed by the text, like "variable x".
+func highlights(t *testing.T, cfg *types.Configuration, source string) []string {
+	t.Helper()
+
+	injectionCallback := func(languageName string) *types.Configuration {
+		if languageName == cfg.LanguageName {
+			return cfg
+		}
+		return nil
+	}
+
+	var (
+		result []string
+		starts []uint
+		names  []string
+		offset uint
+	)
+	for event, err := range highlight.HighlightEvents(context.Background(), *cfg, source, injectionCallback) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e := event.(type) {
+		case highlight.EventCaptureStart:
+			starts = append(starts, offset)
+			names = append(names, testlang.Names[e.Highlight])
+		case highlight.EventCaptureEnd:
+			start, name := starts[len(starts)-1], names[len(names)-1]
+			starts, names = starts[:len(starts)-1], names[:len(names)-1]
+			result = append(result, name+" "+source[start:offset])
+		case highlight.EventSource:
+			offset = e.EndByte
+		}
+	}
+	return result
+}
+
+func pythonConfig(t *testing.T, highlightsQuery string, injectionQuery string) *types.Configuration {
+	t.Helper()
+
+	cfg, err := config.New(testlang.Language("python").Lang, "python", []byte(highlightsQuery), []byte(injectionQuery), nil, testlang.Names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestPredicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		source string
+		want   []string
+	}{
+		{
+			name:   "lua-match",
+			query:  `((identifier) @constant (#lua-match? @constant "^%u[%u%d_]*$"))`,
+			source: "MAX_SIZE = size_2 + A1",
+			want:   []string{"constant MAX_SIZE", "constant A1"},
+		},
+		{
+			name:   "lua-match isn't anchored",
+			query:  `((identifier) @constant (#lua-match? @constant "%d"))`,
+			source: "a1 = b",
+			want:   []string{"constant a1"},
+		},
+		{
+			name:   "not-lua-match",
+			query:  `((identifier) @variable (#not-lua-match? @variable "^_"))`,
+			source: "_a = b",
+			want:   []string{"variable b"},
+		},
+		{
+			name:   "has-parent",
+			query:  `((identifier) @function (#has-parent? @function "call" "decorator"))`,
+			source: "f(x)",
+			want:   []string{"function f"},
+		},
+		{
+			name:   "not-has-parent",
+			query:  `((identifier) @variable (#not-has-parent? @variable "call"))`,
+			source: "f(x)",
+			want:   []string{"variable x"},
+		},
+		{
+			name:   "has-ancestor",
+			query:  `((integer) @number (#has-ancestor? @number "function_definition"))`,
+			source: "a = 1\ndef f():\n    return 2\n",
+			want:   []string{"number 2"},
+		},
+		{
+			name:   "contains",
+			query:  `((comment) @comment (#contains? @comment "TODO" "FIXME"))`,
+			source: "# TODO: a\n# b\n# FIXME\n",
+			want:   []string{"comment # TODO: a", "comment # FIXME"},
+		},
+		{
+			name:   "not-contains",
+			query:  `((comment) @comment (#not-contains? @comment "TODO"))`,
+			source: "# TODO: a\n# b\n",
+			want:   []string{"comment # b"},
+		},
+		{
+			name:   "unknown predicate",
+			query:  `((integer) @number (#unknown? @number "1"))`,
+			source: "a = 1 + 2",
+			want:   []string{"number 1", "number 2"},
+		},
+		{
+			name:   "negated unknown predicate",
+			query:  `((integer) @number (#not-unknown? @number "1"))`,
+			source: "a = 1 + 2",
+			want:   []string{"number 1", "number 2"},
+		},
+		{
+			name:   "builtin predicate",
+			query:  `((integer) @number (#not-eq? @number "1"))`,
+			source: "a = 1 + 2",
+			want:   []string{"number 2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := pythonConfig(t, tt.query, "")
+			Register(cfg)
+
+			if got := highlights(t, cfg, tt.source); !slices.Equal(got, tt.want) {
+				t.Errorf("got highlights %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredicatesNotRegistered(t *testing.T) {
+	cfg := pythonConfig(t, `((identifier) @constant (#lua-match? @constant "^%u+$"))`, "")
+
+	// Predicates that aren't registered are ignored, so every identifier matches.
+	want := []string{"constant A", "constant b"}
+	if got := highlights(t, cfg, "A = b"); !slices.Equal(got, want) {
+		t.Errorf("got highlights %q, want %q", got, want)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	highlightsQuery := `(string) @string (integer) @number`
+	tests := []struct {
+		name           string
+		injectionQuery string
+		source         string
+		want           []string
+	}{
+		{
+			name: "offset",
+			injectionQuery: `((string) @injection.content
+ (#offset! @injection.content 0 1 0 -1)
+ (#set! injection.language "python")
+ (#set! injection.include-children))`,
+			source: `"1"`,
+			want:   []string{"number 1", `string "1"`},
+		},
+		{
+			name: "offset across lines",
+			injectionQuery: `((string) @injection.content
+ (#offset! @injection.content 1 0 0 -3)
+ (#set! injection.language "python")
+ (#set! injection.include-children))`,
+			source: "\"\"\"1\n2\n3\"\"\"",
+			want:   []string{"number 2", "number 3", "string \"\"\"1\n2\n3\"\"\""},
+		},
+		{
+			name: "trim",
+			injectionQuery: `((string (string_content) @injection.content)
+ (#trim! @injection.content)
+ (#offset! @injection.content 0 0 0 -1)
+ (#set! injection.language "python"))`,
+			source: "\"\"\"12\n\n\"\"\"",
+			want:   []string{"number 1", "string \"\"\"12\n\n\"\"\""},
+		},
+		{
+			name: "gsub",
+			injectionQuery: `((call
+  function: (identifier) @injection.language
+  arguments: (argument_list (string (string_content) @injection.content)))
+ (#gsub! @injection.language "^run_(%l+)$" "%1"))`,
+			source: `run_python("2")`,
+			want:   []string{"number 2", `string "2"`},
+		},
+		{
+			name: "set-lang-from-info-string",
+			injectionQuery: `((call
+  function: (identifier) @_language
+  arguments: (argument_list (string (string_content) @injection.content)))
+ (#set-lang-from-info-string! @_language))`,
+			source: `Python("2")`,
+			want:   []string{"number 2", `string "2"`},
+		},
+		{
+			name: "unknown directive",
+			injectionQuery: `((string (string_content) @injection.content)
+ (#unknown! @injection.content)
+ (#set! injection.language "python"))`,
+			source: `"2"`,
+			want:   []string{"number 2", `string "2"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := pythonConfig(t, highlightsQuery, tt.injectionQuery)
+			Register(cfg)
+
+			if got := highlights(t, cfg, tt.source); !slices.Equal(got, tt.want) {
+				t.Errorf("got highlights %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateLuaPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{pattern: "^%u[%u%d_]*$", want: `(?s)^[[:upper:]][[:upper:][:digit:]_]*$`},
+		{pattern: "a-b", want: `(?s)a*?b`},
+		{pattern: "%s+.-", want: `(?s)[[:space:]]+.*?`},
+		{pattern: "[a-z]-", want: `(?s)[a-z]*?`},
+		// Quantifiers without a single character class before them are
+		// literal characters.
+		{pattern: "-", want: `(?s)\-`},
+		{pattern: "-x", want: `(?s)\-x`},
+		{pattern: "^-", want: `(?s)^\-`},
+		{pattern: "(-)", want: `(?s)(\-)`},
+		{pattern: "(-?)", want: `(?s)(\-?)`},
+		{pattern: "*a", want: `(?s)\*a`},
+		{pattern: "(+)", want: `(?s)(\+)`},
+		{pattern: "a--", want: `(?s)a*?\-`},
+		{pattern: "a*-", want: `(?s)a*\-`},
+		{pattern: "a^b$c", want: `(?s)a\^b\$c`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := translateLuaPattern(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if _, err := regexp.Compile(got); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package highlight
+
+import (
+	"io"
+	"iter"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// LineEndings is how renderers write carriage returns. Set it in
+// [HTMLOptions] or [ANSIOptions]. The byte offsets in highlight events always
+// refer to the source as it is.
+type LineEndings = types.LineEndings
+
+const (
+	// LineEndingsNormalize writes `\r\n` and lone `\r` as `\n`. This is the
+	// default.
+	LineEndingsNormalize = types.LineEndingsNormalize
+	// LineEndingsPreserve writes carriage returns as they are, so the text of
+	// the output matches the source byte for byte.
+	LineEndingsPreserve = types.LineEndingsPreserve
+	// LineEndingsVisible writes carriage returns as `␍`, followed by the line
+	// break if there is one.
+	LineEndingsVisible = types.LineEndingsVisible
+)
+
+// Whitespace configures tab expansion and marking tabs, spaces and trailing
+// whitespace in [HTMLOptions] and [ANSIOptions].
+type Whitespace = types.Whitespace
+
+// RenderHTML renders a stream of highlight events, as returned by
+// [HighlightEvents], to w as HTML with a `<span>` for each highlight. Output
+// is written as the events arrive, and writes are buffered.
+func RenderHTML(w io.Writer, events iter.Seq2[Event, error], source string, attributeCallback types.AttributeCallback) error {
+	return html.RenderTo(w, events, source, attributeCallback)
+}
@@ -0,0 +1,183 @@
+package highlight
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+var (
+	sgrPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	tagPattern = regexp.MustCompile("<[^>]*>")
+)
+
+func TestRenderersLineEndings(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		lineEndings LineEndings
+		whitespace  Whitespace
+		want        string
+	}{
+		{name: "normalize", source: "a\r\nb\rc\n", lineEndings: LineEndingsNormalize, want: "a\nb\nc\n"},
+		{name: "preserve", source: "a\r\nb\rc\n", lineEndings: LineEndingsPreserve, want: "a\r\nb\rc\n"},
+		{name: "visible", source: "a\r\nb\rc\n", lineEndings: LineEndingsVisible, want: "a␍\nb␍c\n"},
+		{name: "normalize with tabs", source: "a\rb\tc\r\n", lineEndings: LineEndingsNormalize, whitespace: Whitespace{TabWidth: 4}, want: "a\nb   c\n"},
+		{name: "visible with tabs", source: "a\rb\tc\r\n", lineEndings: LineEndingsVisible, whitespace: Whitespace{TabWidth: 4}, want: "a␍b c␍\n"},
+		{name: "normalize with line break after tab", source: "a\t\r\nb", lineEndings: LineEndingsNormalize, whitespace: Whitespace{TabWidth: 4}, want: "a   \nb"},
+	}
+
+	cfg := testlang.Config(t, "python")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ansiOut bytes.Buffer
+			err := HighlightANSI(context.Background(), &ansiOut, *cfg, tt.source, nil, func(h types.CaptureIndex, languageName string) types.Style {
+				return types.Style{Bold: true}
+			}, ANSIOptions{
+				ColorDepth:  ColorDepthTrueColor,
+				LineEndings: tt.lineEndings,
+				Whitespace:  tt.whitespace,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var htmlOut bytes.Buffer
+			err = HighlightHTML(context.Background(), &htmlOut, *cfg, tt.source, nil, func(h types.CaptureIndex, languageName string) string {
+				return `class="highlight"`
+			}, HTMLOptions{
+				LineEndings: tt.lineEndings,
+				Whitespace:  tt.whitespace,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ansiText := sgrPattern.ReplaceAllString(ansiOut.String(), "")
+			htmlText := html.UnescapeString(tagPattern.ReplaceAllString(htmlOut.String(), ""))
+			if ansiText != tt.want {
+				t.Errorf("got ANSI text %q, want %q", ansiText, tt.want)
+			}
+			if htmlText != tt.want {
+				t.Errorf("got HTML text %q, want %q", htmlText, tt.want)
+			}
+		})
+	}
+}
+
+var tableLinePattern = regexp.MustCompile(`(?s)<td class="line-number">(\d+)</td><td class="line-content">(.*?)</td></tr>`)
+
+func TestRenderHTMLLineNumbersLineEndings(t *testing.T) {
+	tests := []struct {
+		name        string
+		source      string
+		lineEndings LineEndings
+		window      *LineRange
+		want        []string
+	}{
+		{name: "normalize", source: "a\rb\r\nc\n", lineEndings: LineEndingsNormalize, want: []string{"1 a", "2 b", "3 c"}},
+		{name: "preserve", source: "a\rb\r\nc\n", lineEndings: LineEndingsPreserve, want: []string{"1 a\rb\r", "2 c"}},
+		{name: "visible", source: "a\rb\r\nc\n", lineEndings: LineEndingsVisible, want: []string{"1 a␍b␍", "2 c"}},
+		{name: "normalize window", source: "a\rb\r\nc\rd\n", lineEndings: LineEndingsNormalize, window: &LineRange{Start: 3, End: 4}, want: []string{"3 c", "4 d"}},
+	}
+
+	cfg := testlang.Config(t, "python")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := HTMLOptions{
+				LineNumbers: LineNumbersTable,
+				LineEndings: tt.lineEndings,
+			}
+			events := HighlightEvents(context.Background(), *cfg, tt.source, nil)
+			if tt.window != nil {
+				options.StartLine = tt.window.Start
+				events = HighlightEventsWindow(context.Background(), *cfg, tt.source, nil, LineWindow(tt.source, *tt.window))
+			}
+
+			var out bytes.Buffer
+			if err := RenderHTMLWithOptions(&out, events, tt.source, func(h types.CaptureIndex, languageName string) string {
+				return `class="highlight"`
+			}, options); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, match := range tableLinePattern.FindAllStringSubmatch(out.String(), -1) {
+				got = append(got, match[1]+" "+html.UnescapeString(tagPattern.ReplaceAllString(match[2], "")))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got lines %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightLinesCarriageReturns(t *testing.T) {
+	cfg := testlang.Config(t, "python")
+	got, err := HighlightLines(context.Background(), *cfg, "a = 1\rb = 2\r\nc = 3\n", nil, func(h types.CaptureIndex, languageName string) string {
+		return `class="highlight"`
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, line := range got {
+		got[i] = tagPattern.ReplaceAllString(line, "")
+	}
+	if want := []string{"a = 1", "b = 2", "c = 3"}; !slices.Equal(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
+
+func TestHighlightLinesInjections(t *testing.T) {
+	// The string is highlighted in the outer layer and stays open across the
+	// lines of the injected code.
+	source := "exec(\"\"\"a = 1\nb = 2\"\"\")\nx = 3\n"
+	cfg := testlang.Config(t, "python")
+	got, err := HighlightLines(context.Background(), *cfg, source, testlang.InjectionCallback(t), func(h types.CaptureIndex, languageName string) string {
+		return fmt.Sprintf(`class="%s %s"`, languageName, testlang.Names[h])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`<span class="python function.builtin">exec</span>(<span class="python string">&#34;&#34;&#34;<span class="python variable">a</span> <span class="python operator">=</span> <span class="python number">1</span></span>`,
+		`<span class="python string"><span class="python variable">b</span> <span class="python operator">=</span> <span class="python number">2</span>&#34;&#34;&#34;</span>)`,
+		`<span class="python variable">x</span> <span class="python operator">=</span> <span class="python number">3</span>`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got lines\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestHighlightHTMLLineNumbersInjections(t *testing.T) {
+	source := "exec(\"\"\"a = 1\nb = 2\"\"\")\nx = 3\n"
+	cfg := testlang.Config(t, "python")
+	var out bytes.Buffer
+	err := HighlightHTML(context.Background(), &out, *cfg, source, testlang.InjectionCallback(t), func(h types.CaptureIndex, languageName string) string {
+		return `class="highlight"`
+	}, HTMLOptions{LineNumbers: LineNumbersTable})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, match := range tableLinePattern.FindAllStringSubmatch(out.String(), -1) {
+		if opened, closed := strings.Count(match[2], "<span"), strings.Count(match[2], "</span>"); opened != closed {
+			t.Errorf("line %s opens %d spans and closes %d: %s", match[1], opened, closed, match[2])
+		}
+		got = append(got, match[1]+" "+html.UnescapeString(tagPattern.ReplaceAllString(match[2], "")))
+	}
+	if want := []string{"1 exec(\"\"\"a = 1", "2 b = 2\"\"\")", "3 x = 3"}; !slices.Equal(got, want) {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package semantictokens
+
+import (
+	"fmt"
+	"iter"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	highlight "github.com/noclaps/go-tree-sitter-highlight"
+)
+
+// Token is a semantic token with an absolute position. Columns and lengths
+// are in UTF-16 code units, like the default position encoding of the LSP.
+type Token struct {
+	Line      uint32
+	StartChar uint32
+	Length    uint32
+	// TokenType is the index of the token type in the legend.
+	TokenType uint32
+	// TokenModifiers is a bit set of the indices of the modifiers in the legend.
+	TokenModifiers uint32
+}
+
+// Encoder turns highlight events into semantic tokens. It is safe for
+// concurrent use.
+type Encoder struct {
+	legend  Legend
+	mapping map[string]Mapping
+}
+
+// NewEncoder creates an encoder for the legend. The mapping gives the token
+// type and modifiers of capture names, and is [DefaultMapping] if it is nil.
+func NewEncoder(legend Legend, mapping map[string]Mapping) *Encoder {
+	if mapping == nil {
+		mapping = DefaultMapping
+	}
+	return &Encoder{
+		legend:  legend,
+		mapping: mapping,
+	}
+}
+
+// Tokens returns the semantic tokens of a stream of highlight events, as
+// returned by [highlight.HighlightEvents]. Nested highlights are flattened,
+// so the innermost highlight with a token type gives the type of its text.
+// Tokens don't span lines, so highlights over multiple lines are split into
+// a token per line. For `textDocument/semanticTokens/range` requests, use
+// the events of [highlight.HighlightEventsWindow].
+func (e *Encoder) Tokens(events iter.Seq2[highlight.Event, error], source string) ([]Token, error) {
+	// types caches the token types of the capture names.
+	types := map[string]*tokenType{}
+	resolveCached := func(captureName string) *tokenType {
+		if t, ok := types[captureName]; ok {
+			return t
+		}
+		var result *tokenType
+		if t, ok := resolve(e.legend, e.mapping, captureName); ok {
+			result = &t
+		}
+		types[captureName] = result
+		return result
+	}
+
+	var tokens []Token
+	add := func(line uint32, startChar uint32, length uint32, t *tokenType) {
+		if length == 0 {
+			return
+		}
+		// Merge with the previous token if they are the same and adjacent, e.g.
+		// around a nested highlight without a token type.
+		if len(tokens) > 0 {
+			last := &tokens[len(tokens)-1]
+			if last.Line == line && last.StartChar+last.Length == startChar && last.TokenType == t.typ && last.TokenModifiers == t.modifiers {
+				last.Length += length
+				return
+			}
+		}
+		tokens = append(tokens, Token{
+			Line:           line,
+			StartChar:      startChar,
+			Length:         length,
+			TokenType:      t.typ,
+			TokenModifiers: t.modifiers,
+		})
+	}
+
+	// stack holds the token types of the open highlights, nil for highlights without one.
+	var stack []*tokenType
+	s := &scanner{source: source}
+	for event, err := range events {
+		if err != nil {
+			return nil, fmt.Errorf("error while encoding semantic tokens: %w", err)
+		}
+
+		switch event := event.(type) {
+		case highlight.EventCaptureStart:
+			stack = append(stack, resolveCached(event.Name))
+		case highlight.EventCaptureEnd:
+			stack = stack[:len(stack)-1]
+		case highlight.EventSource:
+			var current *tokenType
+			for i := len(stack) - 1; i >= 0 && current == nil; i-- {
+				current = stack[i]
+			}
+
+			s.advance(event.StartByte)
+			if current == nil {
+				s.advance(event.EndByte)
+				continue
+			}
+
+			end := min(event.EndByte, uint(len(source)))
+			startLine, startChar := s.line, s.char
+			for s.offset < end {
+				char := s.char
+				if s.next() {
+					add(startLine, startChar, char-startChar, current)
+					startLine, startChar = s.line, s.char
+				}
+			}
+			add(startLine, startChar, s.char-startChar, current)
+		}
+	}
+
+	return tokens, nil
+}
+
+// Encode returns the delta-encoded data of the semantic tokens of a stream of
+// highlight events, for the `data` of a semantic tokens response. See
+// [Encoder.Tokens].
+func (e *Encoder) Encode(events iter.Seq2[highlight.Event, error], source string) ([]uint32, error) {
+	tokens, err := e.Tokens(events, source)
+	if err != nil {
+		return nil, err
+	}
+	return Encode(tokens), nil
+}
+
+// Encode returns the delta-encoded data of the tokens, which must be sorted
+// by position. Every token is encoded as five integers: the line relative to
+// the previous token, the start character relative to the previous token if
+// it is on the same line, the length, the token type and the modifiers.
+func Encode(tokens []Token) []uint32 {
+	data := make([]uint32, 0, len(tokens)*5)
+	var prevLine, prevChar uint32
+	for _, token := range tokens {
+		deltaLine := token.Line - prevLine
+		deltaChar := token.StartChar
+		if deltaLine == 0 {
+			deltaChar -= prevChar
+		}
+		data = append(data, deltaLine, deltaChar, token.Length, token.TokenType, token.TokenModifiers)
+		prevLine, prevChar = token.Line, token.StartChar
+	}
+	return data
+}
+
+// scanner keeps track of the LSP position of a byte offset in the source.
+type scanner struct {
+	source string
+	offset uint
+	line   uint32
+	// char is the column in UTF-16 code units.
+	char uint32
+}
+
+// next moves over the next character, and reports whether it was a line
+// break. Line breaks are `\n`, `\r\n` and `\r`.
+func (s *scanner) next() bool {
+	r, size := utf8.DecodeRuneInString(s.source[s.offset:])
+	s.offset += uint(size)
+
+	switch r {
+	case '\r':
+		if s.offset < uint(len(s.source)) && s.source[s.offset] == '\n' {
+			// The `\n` is the line break.
+			return false
+		}
+		fallthrough
+	case '\n':
+		s.line++
+		s.char = 0
+		return true
+	}
+
+	if n := utf16.RuneLen(r); n > 0 {
+		s.char += uint32(n)
+	} else {
+		s.char++
+	}
+	return false
+}
+
+// advance moves to the offset.
+func (s *scanner) advance(offset uint) {
+	offset = min(offset, uint(len(s.source)))
+	for s.offset < offset {
+		s.next()
+	}
+}
@@ -0,0 +1,225 @@
+package semantictokens
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"slices"
+	"testing"
+
+	highlight "github.com/noclaps/go-tree-sitter-highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+)
+
+// span is a highlight of the tests, from the start to the end byte.
+type span struct {
+	name  string
+	start uint
+	end   uint
+}
+
+// spanEvents returns the events of the highlights, which must be sorted by
+// their start and nested properly.
+func spanEvents(source string, spans ...span) iter.Seq2[highlight.Event, error] {
+	return func(yield func(highlight.Event, error) bool) {
+		var (
+			offset uint
+			ends   []uint
+		)
+		text := func(end uint) bool {
+			if offset == end {
+				return true
+			}
+			start := offset
+			offset = end
+			return yield(highlight.EventSource{StartByte: start, EndByte: end}, nil)
+		}
+		closeUntil := func(position uint) bool {
+			for len(ends) > 0 && ends[len(ends)-1] <= position {
+				if !text(ends[len(ends)-1]) || !yield(highlight.EventCaptureEnd{}, nil) {
+					return false
+				}
+				ends = ends[:len(ends)-1]
+			}
+			return true
+		}
+
+		if !yield(highlight.EventLayerStart{LanguageName: "test"}, nil) {
+			return
+		}
+		for _, s := range spans {
+			if !closeUntil(s.start) || !text(s.start) || !yield(highlight.EventCaptureStart{Name: s.name}, nil) {
+				return
+			}
+			ends = append(ends, s.end)
+		}
+		if closeUntil(uint(len(source))) {
+			text(uint(len(source)))
+		}
+	}
+}
+
+func TestEncoderTokens(t *testing.T) {
+	// The indices of the types and modifiers in the default legend.
+	const (
+		parameter = 7
+		variable  = 8
+		function  = 12
+		keyword   = 15
+		comment   = 17
+		str       = 18
+
+		readonly       = 1 << 2
+		defaultLibrary = 1 << 9
+	)
+
+	tests := []struct {
+		name   string
+		source string
+		spans  []span
+		want   []Token
+	}{
+		{
+			name:   "tokens",
+			source: "x = print(y)",
+			spans:  []span{{"variable", 0, 1}, {"operator", 2, 3}, {"function.builtin", 4, 9}, {"punctuation.bracket", 9, 10}, {"variable.parameter", 10, 11}},
+			want: []Token{
+				{Line: 0, StartChar: 0, Length: 1, TokenType: variable},
+				{Line: 0, StartChar: 2, Length: 1, TokenType: 21},
+				{Line: 0, StartChar: 4, Length: 5, TokenType: function, TokenModifiers: defaultLibrary},
+				{Line: 0, StartChar: 10, Length: 1, TokenType: parameter},
+			},
+		},
+		{
+			name:   "utf-16 columns",
+			source: "s = \"é😀\" + x",
+			spans:  []span{{"string", 4, 12}, {"variable", 15, 16}},
+			want: []Token{
+				// é is one UTF-16 code unit and 😀 is a surrogate pair.
+				{Line: 0, StartChar: 4, Length: 5, TokenType: str},
+				{Line: 0, StartChar: 12, Length: 1, TokenType: variable},
+			},
+		},
+		{
+			name:   "multi-line tokens",
+			source: "/* a\n😀b\r\nc\rd */ x",
+			spans:  []span{{"comment", 0, 18}, {"constant", 19, 20}},
+			want: []Token{
+				{Line: 0, StartChar: 0, Length: 4, TokenType: comment},
+				{Line: 1, StartChar: 0, Length: 3, TokenType: comment},
+				{Line: 2, StartChar: 0, Length: 1, TokenType: comment},
+				{Line: 3, StartChar: 0, Length: 4, TokenType: comment},
+				{Line: 3, StartChar: 5, Length: 1, TokenType: variable, TokenModifiers: readonly},
+			},
+		},
+		{
+			name:   "nested highlights",
+			source: `"a{b}c"`,
+			spans:  []span{{"string", 0, 7}, {"punctuation.special", 2, 3}, {"keyword", 3, 4}},
+			want: []Token{
+				// The punctuation has no token type, so the string continues over it.
+				{Line: 0, StartChar: 0, Length: 3, TokenType: str},
+				{Line: 0, StartChar: 3, Length: 1, TokenType: keyword},
+				{Line: 0, StartChar: 4, Length: 3, TokenType: str},
+			},
+		},
+		{
+			name:   "nested highlights without a type",
+			source: "a b",
+			spans:  []span{{"punctuation", 0, 3}, {"variable", 2, 3}},
+			want: []Token{
+				{Line: 0, StartChar: 2, Length: 1, TokenType: variable},
+			},
+		},
+		{
+			name:   "empty",
+			source: "",
+			want:   nil,
+		},
+	}
+
+	encoder := NewEncoder(DefaultLegend, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encoder.Tokens(spanEvents(tt.source, tt.spans...), tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got tokens\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []Token
+		want   []uint32
+	}{
+		{
+			name:   "none",
+			tokens: nil,
+			want:   []uint32{},
+		},
+		{
+			name: "same line",
+			tokens: []Token{
+				{Line: 2, StartChar: 5, Length: 3, TokenType: 1, TokenModifiers: 4},
+				{Line: 2, StartChar: 10, Length: 2, TokenType: 2},
+			},
+			want: []uint32{2, 5, 3, 1, 4, 0, 5, 2, 2, 0},
+		},
+		{
+			name: "next lines",
+			tokens: []Token{
+				{Line: 0, StartChar: 4, Length: 1, TokenType: 3},
+				{Line: 1, StartChar: 2, Length: 1, TokenType: 3},
+				{Line: 4, StartChar: 8, Length: 6, TokenType: 0, TokenModifiers: 3},
+			},
+			want: []uint32{0, 4, 1, 3, 0, 1, 2, 1, 3, 0, 3, 8, 6, 0, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Encode(tt.tokens); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncoderEncode(t *testing.T) {
+	// Tokens get the type of the capture name, so the reference of the
+	// parameter is a variable.
+	source := "def f(x):\n    return x\n"
+	cfg := testlang.Config(t, "python")
+
+	encoder := NewEncoder(DefaultLegend, nil)
+	got, err := encoder.Encode(highlight.HighlightEvents(context.Background(), *cfg, source, nil), source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []uint32{
+		0, 0, 3, 15, 0, // def
+		0, 4, 1, 12, 0, // f
+		0, 2, 1, 7, 0, // x
+		1, 4, 6, 15, 0, // return
+		0, 7, 1, 8, 0, // x
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got data %v, want %v", got, want)
+	}
+}
+
+func TestEncoderTokensError(t *testing.T) {
+	events := func(yield func(highlight.Event, error) bool) {
+		yield(nil, context.Canceled)
+	}
+	_, err := NewEncoder(DefaultLegend, nil).Tokens(events, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
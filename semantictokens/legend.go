@@ -0,0 +1,114 @@
+// Package semantictokens encodes highlight events as semantic tokens for the
+// Language Server Protocol, for `textDocument/semanticTokens/full` and
+// `textDocument/semanticTokens/range` responses.
+package semantictokens
+
+import (
+	"slices"
+	"strings"
+)
+
+// Legend is the semantic tokens legend that the server sends to the client
+// in its capabilities. Token types and modifiers are encoded as their indices
+// in it.
+type Legend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+// DefaultLegend has the predefined token types and modifiers of the LSP
+// specification.
+var DefaultLegend = Legend{
+	TokenTypes: []string{
+		"namespace", "type", "class", "enum", "interface", "struct", "typeParameter", "parameter",
+		"variable", "property", "enumMember", "event", "function", "method", "macro", "keyword",
+		"modifier", "comment", "string", "number", "regexp", "operator", "decorator",
+	},
+	TokenModifiers: []string{
+		"declaration", "definition", "readonly", "static", "deprecated", "abstract", "async",
+		"modification", "documentation", "defaultLibrary",
+	},
+}
+
+// Mapping is the token type and modifiers of a capture name.
+type Mapping struct {
+	Type      string
+	Modifiers []string
+}
+
+// DefaultMapping maps common capture names of highlight queries to the token
+// types and modifiers of [DefaultLegend].
+var DefaultMapping = map[string]Mapping{
+	"attribute":             {Type: "decorator"},
+	"comment":               {Type: "comment"},
+	"comment.documentation": {Type: "comment", Modifiers: []string{"documentation"}},
+	"constant":              {Type: "variable", Modifiers: []string{"readonly"}},
+	"constant.macro":        {Type: "macro"},
+	"constructor":           {Type: "class"},
+	"function":              {Type: "function"},
+	"function.macro":        {Type: "macro"},
+	"function.method":       {Type: "method"},
+	"keyword":               {Type: "keyword"},
+	"module":                {Type: "namespace"},
+	"namespace":             {Type: "namespace"},
+	"number":                {Type: "number"},
+	"float":                 {Type: "number"},
+	"operator":              {Type: "operator"},
+	"parameter":             {Type: "parameter"},
+	"property":              {Type: "property"},
+	"string":                {Type: "string"},
+	"string.regex":          {Type: "regexp"},
+	"string.regexp":         {Type: "regexp"},
+	"type":                  {Type: "type"},
+	"type.parameter":        {Type: "typeParameter"},
+	"variable":              {Type: "variable"},
+	"variable.member":       {Type: "property"},
+	"variable.parameter":    {Type: "parameter"},
+}
+
+// modifierAliases maps parts of capture names to the modifiers they mean.
+var modifierAliases = map[string]string{
+	"builtin": "defaultLibrary",
+}
+
+// tokenType is the encoded type and modifiers of a capture name.
+type tokenType struct {
+	typ       uint32
+	modifiers uint32
+}
+
+// resolve returns the token type of a capture name, or false if it has none in
+// the legend. The longest dot-separated prefix of the name that is in the
+// mapping gives the type. The remaining parts of the name add modifiers if
+// they are in the legend, like `definition` or `builtin` for
+// `defaultLibrary`.
+func resolve(legend Legend, mapping map[string]Mapping, captureName string) (tokenType, bool) {
+	parts := strings.Split(captureName, ".")
+	for i := len(parts); i > 0; i-- {
+		m, ok := mapping[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+
+		typ := slices.Index(legend.TokenTypes, m.Type)
+		if typ == -1 {
+			return tokenType{}, false
+		}
+		result := tokenType{typ: uint32(typ)}
+
+		modifiers := slices.Clone(m.Modifiers)
+		for _, part := range parts[i:] {
+			if alias, ok := modifierAliases[part]; ok {
+				part = alias
+			}
+			modifiers = append(modifiers, part)
+		}
+		for _, modifier := range modifiers {
+			if index := slices.Index(legend.TokenModifiers, modifier); index != -1 && index < 32 {
+				result.modifiers |= 1 << index
+			}
+		}
+		return result, true
+	}
+	return tokenType{}, false
+}
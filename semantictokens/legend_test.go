@@ -0,0 +1,78 @@
+package semantictokens
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	legend := Legend{
+		TokenTypes:     []string{"function", "variable", "comment"},
+		TokenModifiers: []string{"declaration", "readonly", "defaultLibrary", "documentation"},
+	}
+	mapping := map[string]Mapping{
+		"function":              {Type: "function"},
+		"function.method":       {Type: "method"},
+		"variable":              {Type: "variable"},
+		"constant":              {Type: "variable", Modifiers: []string{"readonly"}},
+		"comment":               {Type: "comment"},
+		"comment.documentation": {Type: "comment", Modifiers: []string{"documentation", "deprecated"}},
+	}
+
+	tests := []struct {
+		captureName string
+		want        tokenType
+		wantOK      bool
+	}{
+		{captureName: "function", want: tokenType{typ: 0}, wantOK: true},
+		{captureName: "variable", want: tokenType{typ: 1}, wantOK: true},
+		{captureName: "constant", want: tokenType{typ: 1, modifiers: 1 << 1}, wantOK: true},
+		// Parts after the mapped name add the modifiers that are in the legend.
+		{captureName: "function.builtin", want: tokenType{typ: 0, modifiers: 1 << 2}, wantOK: true},
+		{captureName: "function.declaration.builtin", want: tokenType{typ: 0, modifiers: 1<<0 | 1<<2}, wantOK: true},
+		{captureName: "variable.unknown", want: tokenType{typ: 1}, wantOK: true},
+		{captureName: "constant.builtin", want: tokenType{typ: 1, modifiers: 1<<1 | 1<<2}, wantOK: true},
+		// Modifiers of the mapping that aren't in the legend are left out.
+		{captureName: "comment.documentation", want: tokenType{typ: 2, modifiers: 1 << 3}, wantOK: true},
+		// The longest mapped prefix wins, even if its type isn't in the legend.
+		{captureName: "function.method", wantOK: false},
+		{captureName: "function.method.builtin", wantOK: false},
+		{captureName: "punctuation", wantOK: false},
+		{captureName: "", wantOK: false},
+	}
+	for _, tt := range tests {
+		got, ok := resolve(legend, mapping, tt.captureName)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("resolve(%q) = %+v, %t, want %+v, %t", tt.captureName, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestResolveModifierBits(t *testing.T) {
+	// Only the first 32 modifiers fit in the bit set.
+	legend := Legend{TokenTypes: []string{"variable"}}
+	for i := range 33 {
+		legend.TokenModifiers = append(legend.TokenModifiers, string(rune('a'+i%26))+string(rune('a'+i/26)))
+	}
+
+	tests := []struct {
+		captureName string
+		want        uint32
+	}{
+		{captureName: "variable.aa", want: 1},
+		{captureName: "variable.fb", want: 1 << 31},
+		{captureName: "variable.gb", want: 0},
+		{captureName: "variable.aa.fb", want: 1<<0 | 1<<31},
+	}
+	for _, tt := range tests {
+		got, ok := resolve(legend, DefaultMapping, tt.captureName)
+		if !ok || got.modifiers != tt.want {
+			t.Errorf("resolve(%q) = %+v, %t, want modifiers %b", tt.captureName, got, ok, tt.want)
+		}
+	}
+}
+
+func TestDefaultMapping(t *testing.T) {
+	for captureName, m := range DefaultMapping {
+		if _, ok := resolve(DefaultLegend, DefaultMapping, captureName); !ok {
+			t.Errorf("the type %q of %q isn't in the default legend", m.Type, captureName)
+		}
+	}
+}
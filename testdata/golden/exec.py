@@ -0,0 +1,6 @@
+def run(code):
+    exec(code)
+
+exec("exec('a = 1'); exec('b = 2')")
+exec("exec('''c = 3''')")
+print(len("done"))
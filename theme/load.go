@@ -0,0 +1,554 @@
+package theme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// namedColors are the color names that can be used instead of hex colors.
+// They are the 16 standard terminal colors, with the names used by Helix.
+var namedColors = map[string]types.Color{
+	"black":         {R: 0, G: 0, B: 0},
+	"red":           {R: 205, G: 0, B: 0},
+	"green":         {R: 0, G: 205, B: 0},
+	"yellow":        {R: 205, G: 205, B: 0},
+	"blue":          {R: 0, G: 0, B: 238},
+	"magenta":       {R: 205, G: 0, B: 205},
+	"cyan":          {R: 0, G: 205, B: 205},
+	"gray":          {R: 229, G: 229, B: 229},
+	"light-gray":    {R: 229, G: 229, B: 229},
+	"grey":          {R: 229, G: 229, B: 229},
+	"light-red":     {R: 255, G: 0, B: 0},
+	"light-green":   {R: 0, G: 255, B: 0},
+	"light-yellow":  {R: 255, G: 255, B: 0},
+	"light-blue":    {R: 92, G: 92, B: 255},
+	"light-magenta": {R: 255, G: 0, B: 255},
+	"light-cyan":    {R: 0, G: 255, B: 255},
+	"white":         {R: 255, G: 255, B: 255},
+}
+
+// ParseColor parses a color in `#rrggbb` or `#rgb` notation, a name from the
+// palette, or one of the standard terminal color names like `red` or
+// `light-blue`.
+func ParseColor(s string, palette map[string]types.Color) (types.Color, error) {
+	if c, ok := palette[s]; ok {
+		return c, nil
+	}
+
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) == 6 {
+			if v, err := strconv.ParseUint(hex, 16, 32); err == nil {
+				return types.Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+			}
+		}
+		return types.Color{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	return types.Color{}, fmt.Errorf("unknown color %q", s)
+}
+
+// LoadFile loads a theme from a file. The format is picked by the file
+// extension: `.json` files are read with [LoadJSON], or with [LoadNeovim] if
+// they have no `styles` key, `.toml` files with [LoadTOML], or with
+// [LoadHelix] if they have no `styles` table, and `.lua` and `.vim` files
+// with [LoadNeovim].
+func LoadFile(path string) (*Theme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t *Theme
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error parsing theme %s: %w", path, err)
+		}
+		if _, ok := doc["styles"]; ok {
+			t, err = LoadJSON(data)
+		} else {
+			t, err = LoadNeovim(data)
+		}
+	case ".toml":
+		doc, parseErr := parseTOML(string(data))
+		if parseErr != nil {
+			return nil, fmt.Errorf("error parsing theme %s: %w", path, parseErr)
+		}
+		if _, ok := doc["styles"]; ok {
+			t, err = fromDocument(doc)
+		} else {
+			t, err = fromHelix(doc)
+		}
+	case ".lua", ".vim":
+		t, err = LoadNeovim(data)
+	default:
+		return nil, fmt.Errorf("unknown theme format %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading theme %s: %w", path, err)
+	}
+
+	if t.Name == "" {
+		t.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return t, nil
+}
+
+// LoadJSON loads a theme from JSON, in this format:
+//
+//	{
+//	  "name": "my-theme",
+//	  "palette": { "purple": "#c678dd" },
+//	  "styles": {
+//	    "comment": "#5c6370",
+//	    "keyword": { "fg": "purple", "bold": true },
+//	    "function.builtin": { "fg": "#61afef", "modifiers": ["italic"] }
+//	  }
+//	}
+//
+// A style is either a foreground color, or an object with `fg`, `bg`, `bold`,
+// `italic`, `underline`, `strikethrough` and `modifiers` keys. Colors are
+// parsed with [ParseColor].
+func LoadJSON(data []byte) (*Theme, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing theme: %w", err)
+	}
+	return fromDocument(doc)
+}
+
+// LoadTOML loads a theme from TOML, in the same format as [LoadJSON]:
+//
+//	name = "my-theme"
+//
+//	[palette]
+//	purple = "#c678dd"
+//
+//	[styles]
+//	comment = "#5c6370"
+//	keyword = { fg = "purple", bold = true }
+//	"function.builtin" = { fg = "#61afef", modifiers = ["italic"] }
+//
+// Only the subset of TOML that themes need is supported: multi-line strings,
+// multi-line inline tables, arrays of tables and dates and times are errors.
+func LoadTOML(data []byte) (*Theme, error) {
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing theme: %w", err)
+	}
+	return fromDocument(doc)
+}
+
+// LoadHelix loads a Helix editor theme. Scopes are used as capture names, and
+// the `palette` table and `modifiers` lists are supported. `inherits` is
+// ignored. The TOML is limited like in [LoadTOML].
+func LoadHelix(data []byte) (*Theme, error) {
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing theme: %w", err)
+	}
+	return fromHelix(doc)
+}
+
+func fromDocument(doc map[string]any) (*Theme, error) {
+	palette, err := parsePalette(doc["palette"])
+	if err != nil {
+		return nil, err
+	}
+
+	styles, ok := doc["styles"].(map[string]any)
+	if doc["styles"] != nil && !ok {
+		return nil, errors.New("styles must be a table")
+	}
+
+	name, _ := doc["name"].(string)
+	t := New(name, nil)
+	if err := addStyles(t, "", styles, palette); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func fromHelix(doc map[string]any) (*Theme, error) {
+	palette, err := parsePalette(doc["palette"])
+	if err != nil {
+		return nil, err
+	}
+
+	styles := make(map[string]any, len(doc))
+	for key, value := range doc {
+		if key != "palette" && key != "inherits" {
+			styles[key] = value
+		}
+	}
+
+	t := New("", nil)
+	if err := addStyles(t, "", styles, palette); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parsePalette(value any) (map[string]types.Color, error) {
+	palette := map[string]types.Color{}
+	if value == nil {
+		return palette, nil
+	}
+
+	table, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("palette must be a table")
+	}
+	for name, v := range table {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("palette color %s must be a string", name)
+		}
+		c, err := ParseColor(s, nil)
+		if err != nil {
+			return nil, fmt.Errorf("palette color %s: %w", name, err)
+		}
+		palette[name] = c
+	}
+	return palette, nil
+}
+
+// styleKeys are the keys of a style table. Tables without any of them are
+// nested scopes, as created by dotted keys in TOML.
+var styleKeys = []string{"fg", "bg", "modifiers", "underline", "bold", "italic", "strikethrough"}
+
+func addStyles(t *Theme, prefix string, styles map[string]any, palette map[string]types.Color) error {
+	for name, value := range styles {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if table, ok := value.(map[string]any); ok && !hasAnyKey(table, styleKeys) {
+			if err := addStyles(t, name, table, palette); err != nil {
+				return err
+			}
+			continue
+		}
+
+		style, err := parseStyle(value, palette)
+		if err != nil {
+			return fmt.Errorf("style %s: %w", name, err)
+		}
+		t.Set(name, style)
+	}
+	return nil
+}
+
+func hasAnyKey(table map[string]any, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := table[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseStyle(value any, palette map[string]types.Color) (types.Style, error) {
+	var style types.Style
+
+	color := func(v any) (*types.Color, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("color must be a string, got %v", v)
+		}
+		c, err := ParseColor(s, palette)
+		if err != nil {
+			return nil, err
+		}
+		return &c, nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		c, err := color(v)
+		if err != nil {
+			return style, err
+		}
+		style.Foreground = c
+		return style, nil
+	case map[string]any:
+		var err error
+		if fg, ok := v["fg"]; ok {
+			if style.Foreground, err = color(fg); err != nil {
+				return style, err
+			}
+		}
+		if bg, ok := v["bg"]; ok {
+			if style.Background, err = color(bg); err != nil {
+				return style, err
+			}
+		}
+		style.Bold, _ = v["bold"].(bool)
+		style.Italic, _ = v["italic"].(bool)
+		style.Strikethrough, _ = v["strikethrough"].(bool)
+		switch underline := v["underline"].(type) {
+		case bool:
+			style.Underline = underline
+		case map[string]any:
+			// Helix underlines are tables with a color and a style.
+			style.Underline = true
+		}
+
+		modifiers, _ := v["modifiers"].([]any)
+		for _, modifier := range modifiers {
+			switch modifier {
+			case "bold":
+				style.Bold = true
+			case "italic":
+				style.Italic = true
+			case "underline", "underlined":
+				style.Underline = true
+			case "strikethrough", "crossed_out":
+				style.Strikethrough = true
+			}
+		}
+		return style, nil
+	default:
+		return style, fmt.Errorf("style must be a color or a table, got %v", value)
+	}
+}
+
+var (
+	luaCall      = regexp.MustCompile(`nvim_set_hl\s*\(`)
+	luaHighlight = regexp.MustCompile(`^nvim_set_hl\s*\(\s*\w+\s*,\s*(?:"([^"\\]+)"|'([^'\\]+)')\s*,\s*\{([^{}]*)\}\s*\)`)
+	luaField     = regexp.MustCompile(`^\s*(\w+)\s*=\s*("[^"\\]*"|'[^'\\]*'|\w+)\s*(?:,|$)`)
+	vimHighlight = regexp.MustCompile(`^\s*hi(?:ghlight)?!?\s+(?:def(?:ault)?\s+)?(.*)$`)
+)
+
+// neovimNone is the color value Neovim uses for no color.
+const neovimNone = "NONE"
+
+// neovimColor is a color of a Neovim highlight group, either a color string
+// like `#c678dd` or an RGB integer like `13007069`, as `nvim_get_hl` returns
+// them. Integers are converted to `#rrggbb` strings.
+type neovimColor string
+
+func (c *neovimColor) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = neovimColor(s)
+		return nil
+	}
+	var n uint32
+	if err := json.Unmarshal(data, &n); err != nil || n > 0xffffff {
+		return fmt.Errorf("invalid color %s", data)
+	}
+	*c = neovimColor(fmt.Sprintf("#%06x", n))
+	return nil
+}
+
+// parseNeovimColor parses a color value of Lua code, which is an RGB integer
+// unless it is quoted.
+func parseNeovimColor(value string) neovimColor {
+	if n, err := strconv.ParseUint(value, 0, 24); err == nil {
+		return neovimColor(fmt.Sprintf("#%06x", n))
+	}
+	return neovimColor(strings.Trim(value, `"'`))
+}
+
+// neovimGroup is a Neovim highlight group definition.
+type neovimGroup struct {
+	Fg            neovimColor `json:"fg"`
+	Bg            neovimColor `json:"bg"`
+	Bold          bool        `json:"bold"`
+	Italic        bool        `json:"italic"`
+	Underline     bool        `json:"underline"`
+	Strikethrough bool        `json:"strikethrough"`
+	Link          string      `json:"link"`
+}
+
+// LoadNeovim loads a Neovim color scheme. Only the highlight groups for
+// tree-sitter captures, which start with `@`, are used, without the `@`.
+// `link`s between groups are followed. The data can be
+//   - a JSON object of groups, e.g. `{ "@keyword": { "fg": "#c678dd", "bold": true } }`,
+//     where colors can also be RGB integers as returned by `nvim_get_hl`,
+//   - Lua code with `vim.api.nvim_set_hl(0, "@keyword", { fg = "#c678dd", bold = true })` calls, or
+//   - Vim script with `highlight @keyword guifg=#c678dd gui=bold` and `highlight link` commands.
+//
+// Lua and Vim script aren't run, only these forms are read from them:
+//   - `nvim_set_hl` calls with any prefix, whose group is a string literal and
+//     whose attributes are a table literal without nested tables. Its fields
+//     are `key = value`, where a value is a string literal without escapes, an
+//     integer like `0xc678dd` or `13007069`, `true` or `false`. The `fg`,
+//     `foreground`, `bg`, `background`, `bold`, `italic`, `underline`,
+//     `strikethrough` and `link` keys are used, others are ignored.
+//   - Lines starting with `hi` or `highlight`, with an optional `!` and
+//     `default`, followed by a group and `key=value` attributes, of which
+//     `guifg`, `guibg`, `gui` and `cterm` are used, by `link` and two groups,
+//     or by `clear`, which is ignored. Line continuations are not supported.
+//
+// Other `nvim_set_hl` calls, like ones with a variable for the group or
+// attributes, and malformed `highlight` commands are errors. Anything else is
+// ignored, so groups that are set in loops or with `execute` are not loaded.
+func LoadNeovim(data []byte) (*Theme, error) {
+	groups := map[string]neovimGroup{}
+
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		if err := json.Unmarshal(data, &groups); err != nil {
+			return nil, fmt.Errorf("error parsing theme: %w", err)
+		}
+	} else {
+		if err := parseLuaGroups(string(data), groups); err != nil {
+			return nil, fmt.Errorf("error parsing theme: %w", err)
+		}
+		if err := parseVimGroups(string(data), groups); err != nil {
+			return nil, fmt.Errorf("error parsing theme: %w", err)
+		}
+	}
+
+	t := New("", nil)
+	for name, group := range groups {
+		captureName, ok := strings.CutPrefix(name, "@")
+		if !ok {
+			continue
+		}
+
+		// Follow links, but not forever if they form a cycle.
+		for range len(groups) {
+			if group.Link == "" {
+				break
+			}
+			group = groups[group.Link]
+		}
+
+		style := types.Style{
+			Bold:          group.Bold,
+			Italic:        group.Italic,
+			Underline:     group.Underline,
+			Strikethrough: group.Strikethrough,
+		}
+		if group.Fg != "" && group.Fg != neovimNone {
+			c, err := ParseColor(string(group.Fg), nil)
+			if err != nil {
+				return nil, fmt.Errorf("group %s: %w", name, err)
+			}
+			style.Foreground = &c
+		}
+		if group.Bg != "" && group.Bg != neovimNone {
+			c, err := ParseColor(string(group.Bg), nil)
+			if err != nil {
+				return nil, fmt.Errorf("group %s: %w", name, err)
+			}
+			style.Background = &c
+		}
+		t.Set(captureName, style)
+	}
+	return t, nil
+}
+
+// parseLuaGroups adds the groups of the `nvim_set_hl` calls of Lua code to
+// groups.
+func parseLuaGroups(data string, groups map[string]neovimGroup) error {
+	for _, call := range luaCall.FindAllStringIndex(data, -1) {
+		line := strings.Count(data[:call[0]], "\n") + 1
+		match := luaHighlight.FindStringSubmatch(data[call[0]:])
+		if match == nil {
+			return fmt.Errorf("line %d: unsupported nvim_set_hl call", line)
+		}
+
+		var group neovimGroup
+		for fields := match[3]; strings.TrimSpace(fields) != ""; {
+			field := luaField.FindStringSubmatch(fields)
+			if field == nil {
+				return fmt.Errorf("line %d: unsupported nvim_set_hl field %q", line, strings.TrimSpace(fields))
+			}
+			fields = fields[len(field[0]):]
+
+			value := strings.Trim(field[2], `"'`)
+			switch field[1] {
+			case "fg", "foreground":
+				group.Fg = parseNeovimColor(field[2])
+			case "bg", "background":
+				group.Bg = parseNeovimColor(field[2])
+			case "bold":
+				group.Bold = value == "true"
+			case "italic":
+				group.Italic = value == "true"
+			case "underline":
+				group.Underline = value == "true"
+			case "strikethrough":
+				group.Strikethrough = value == "true"
+			case "link":
+				group.Link = value
+			}
+		}
+		groups[match[1]+match[2]] = group
+	}
+	return nil
+}
+
+// parseVimGroups adds the groups of the `highlight` commands of Vim script to
+// groups.
+func parseVimGroups(data string, groups map[string]neovimGroup) error {
+	inHighlight := false
+	for i, line := range strings.Split(data, "\n") {
+		if inHighlight && strings.HasPrefix(strings.TrimSpace(line), "\\") {
+			return fmt.Errorf("line %d: line continuations of highlight commands are not supported", i+1)
+		}
+		match := vimHighlight.FindStringSubmatch(line)
+		inHighlight = match != nil
+		if match == nil {
+			continue
+		}
+		fields := strings.Fields(match[1])
+		if len(fields) == 0 || fields[0] == "clear" {
+			continue
+		}
+		if fields[0] == "link" {
+			if len(fields) != 3 {
+				return fmt.Errorf("line %d: highlight link needs two groups", i+1)
+			}
+			groups[fields[1]] = neovimGroup{Link: fields[2]}
+			continue
+		}
+
+		group := groups[fields[0]]
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return fmt.Errorf("line %d: invalid highlight attribute %q", i+1, field)
+			}
+			switch key {
+			case "guifg":
+				group.Fg = neovimColor(value)
+			case "guibg":
+				group.Bg = neovimColor(value)
+			case "gui", "cterm":
+				for attribute := range strings.SplitSeq(value, ",") {
+					switch attribute {
+					case "bold":
+						group.Bold = true
+					case "italic":
+						group.Italic = true
+					case "underline":
+						group.Underline = true
+					case "strikethrough":
+						group.Strikethrough = true
+					}
+				}
+			}
+		}
+		groups[fields[0]] = group
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package theme
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+func TestLoadNeovim(t *testing.T) {
+	keyword := types.Style{Foreground: &types.Color{R: 0xc6, G: 0x78, B: 0xdd}, Bold: true}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "json", data: `{"@keyword": {"fg": "#c678dd", "bold": true}, "Normal": {"fg": "#ffffff"}}`},
+		{name: "json with integer colors", data: `{"@keyword": {"fg": 13007069, "bg": "NONE", "bold": true}}`},
+		{name: "json with links", data: `{"@keyword": {"link": "Keyword"}, "Keyword": {"fg": 13007069, "bold": true}}`},
+		{name: "lua", data: `vim.api.nvim_set_hl(0, "@keyword", { fg = "#c678dd", bold = true })`},
+		{name: "lua with integer colors", data: `vim.api.nvim_set_hl(0, "@keyword", { fg = 0xc678dd, bold = true })`},
+		{name: "lua with other fields", data: "local hl = vim.api\nhl.nvim_set_hl(ns, '@keyword', {\n  foreground = '#c678dd',\n  sp = 'red',\n  bold = true,\n})"},
+		{name: "lua with links", data: `vim.api.nvim_set_hl(0, "@keyword", { link = "Keyword" }) vim.api.nvim_set_hl(0, "Keyword", { fg = "#c678dd", bold = true })`},
+		{name: "vim script", data: "highlight @keyword guifg=#c678dd gui=bold\n"},
+		{name: "vim script with links", data: "hi! def link @keyword Keyword\r\nhi clear\r\nhi Keyword ctermfg=5 guifg=#c678dd cterm=bold\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theme, err := LoadNeovim([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := theme.Style("keyword")
+			if !ok {
+				t.Fatal("got no style for keyword")
+			}
+			if got.Foreground == nil || *got.Foreground != *keyword.Foreground || got.Background != nil || got.Bold != keyword.Bold {
+				t.Errorf("got style %+v, want %+v", got, keyword)
+			}
+		})
+	}
+}
+
+func TestLoadNeovimErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"@keyword": {"fg": 16777216}}`,
+		`{"@keyword": {"fg": -1}}`,
+		`{"@keyword": {"fg": true}}`,
+		`{"@keyword": {"fg": "not a color"}}`,
+	} {
+		if _, err := LoadNeovim([]byte(data)); err == nil {
+			t.Errorf("got no error for %s", data)
+		}
+	}
+}
+
+func TestLoadNeovimUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "lua group variable", data: "for name, opts in pairs(groups) do\n  vim.api.nvim_set_hl(0, name, opts)\nend", want: "line 2: unsupported nvim_set_hl call"},
+		{name: "lua attributes variable", data: `vim.api.nvim_set_hl(0, "@keyword", opts)`, want: "line 1: unsupported nvim_set_hl call"},
+		{name: "lua nested table", data: `vim.api.nvim_set_hl(0, "@keyword", { fg = "#c678dd", cterm = { bold = true } })`, want: "line 1: unsupported nvim_set_hl call"},
+		{name: "lua escapes", data: `vim.api.nvim_set_hl(0, "@key\"word", { fg = "#c678dd" })`, want: "line 1: unsupported nvim_set_hl call"},
+		{name: "lua color variable", data: `vim.api.nvim_set_hl(0, "@keyword", { fg = colors.purple })`, want: `line 1: unsupported nvim_set_hl field "fg = colors.purple"`},
+		{name: "lua expression", data: `vim.api.nvim_set_hl(0, "@keyword", { bold = not italic })`, want: `line 1: unsupported nvim_set_hl field "bold = not italic"`},
+		{name: "vim link without target", data: "hi link @keyword", want: "line 1: highlight link needs two groups"},
+		{name: "vim attribute without value", data: "\nhighlight @keyword guifg", want: `line 2: invalid highlight attribute "guifg"`},
+		{name: "vim line continuation", data: "highlight @keyword guifg=#c678dd\n  \\ gui=bold", want: "line 2: line continuations of highlight commands are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadNeovim([]byte(tt.data))
+			if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("got %v, %v, want error %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadNeovimIgnored(t *testing.T) {
+	// These forms aren't read, and don't set any styles.
+	for _, data := range []string{
+		`local groups = { ["@keyword"] = { fg = "#c678dd" } }`,
+		`vim.cmd("highlight @keyword guifg=#c678dd")`,
+		`execute "highlight @keyword guifg=" . s:purple`,
+		"\" highlight @keyword guifg=#c678dd",
+		`vim.api.nvim_set_hl(0, "Keyword", { fg = "#c678dd" })`,
+	} {
+		theme, err := LoadNeovim([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %v", data, err)
+			continue
+		}
+		if style, ok := theme.Style("keyword"); ok {
+			t.Errorf("%s: got style %+v, want none", data, style)
+		}
+	}
+}
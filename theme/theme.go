@@ -0,0 +1,183 @@
+// Package theme maps highlight capture names to styles, and turns them into
+// attribute callbacks, style callbacks and CSS stylesheets.
+package theme
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// Theme maps capture names like `function.method.builtin` to styles.
+type Theme struct {
+	// Name is the name of the theme, if it has one.
+	Name   string
+	styles map[string]types.Style
+}
+
+// New creates a theme from a map of capture names to styles.
+func New(name string, styles map[string]types.Style) *Theme {
+	t := &Theme{
+		Name:   name,
+		styles: make(map[string]types.Style, len(styles)),
+	}
+	for captureName, style := range styles {
+		t.Set(captureName, style)
+	}
+	return t
+}
+
+// Set sets the style for a capture name.
+func (t *Theme) Set(captureName string, style types.Style) {
+	if t.styles == nil {
+		t.styles = make(map[string]types.Style)
+	}
+	t.styles[captureName] = style
+}
+
+// Names returns the capture names the theme has styles for, sorted.
+func (t *Theme) Names() []string {
+	names := make([]string, 0, len(t.styles))
+	for name := range t.styles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Style returns the style for a capture name. If the theme has no style for
+// the full name, the last dotted part is removed until one is found, the same
+// way captures are matched to recognised names, so `function.method.builtin`
+// falls back to `function.method` and then `function`.
+func (t *Theme) Style(captureName string) (types.Style, bool) {
+	for {
+		if style, ok := t.styles[captureName]; ok {
+			return style, true
+		}
+
+		lastDot := strings.LastIndex(captureName, ".")
+		if lastDot == -1 {
+			return types.Style{}, false
+		}
+		captureName = captureName[:lastDot]
+	}
+}
+
+// resolve returns the style of each recognised name.
+func (t *Theme) resolve(recognisedNames []string) []*types.Style {
+	styles := make([]*types.Style, len(recognisedNames))
+	for i, name := range recognisedNames {
+		if style, ok := t.Style(name); ok {
+			styles[i] = &style
+		}
+	}
+	return styles
+}
+
+// StyleCallback returns a [types.StyleCallback] for terminal output, for a
+// configuration that was created with the given recognised names.
+func (t *Theme) StyleCallback(recognisedNames []string) types.StyleCallback {
+	styles := t.resolve(recognisedNames)
+	return func(h types.CaptureIndex, languageName string) types.Style {
+		if int(h) < len(styles) && styles[h] != nil {
+			return *styles[h]
+		}
+		return types.Style{}
+	}
+}
+
+// InlineAttributeCallback returns a [types.AttributeCallback] that adds a
+// `style` attribute with the theme's style to every span, for a configuration
+// that was created with the given recognised names.
+func (t *Theme) InlineAttributeCallback(recognisedNames []string) types.AttributeCallback {
+	attributes := make([]string, len(recognisedNames))
+	for i, style := range t.resolve(recognisedNames) {
+		if style == nil {
+			continue
+		}
+		if css := CSSDeclarations(*style); css != "" {
+			attributes[i] = fmt.Sprintf(`style="%s"`, css)
+		}
+	}
+
+	return func(h types.CaptureIndex, languageName string) string {
+		if int(h) < len(attributes) {
+			return attributes[h]
+		}
+		return ""
+	}
+}
+
+// ClassAttributeCallback returns a [types.AttributeCallback] that adds a
+// `class` attribute to every span, for a configuration that was created with
+// the given recognised names. The class names are the ones used by
+// [Theme.CSS] with the same prefix.
+func (t *Theme) ClassAttributeCallback(recognisedNames []string, prefix string) types.AttributeCallback {
+	return func(h types.CaptureIndex, languageName string) string {
+		if int(h) < len(recognisedNames) {
+			return fmt.Sprintf(`class="%s"`, ClassName(recognisedNames[h], prefix))
+		}
+		return ""
+	}
+}
+
+// CSS returns a stylesheet with a rule for each of the recognised names that
+// the theme has a style for, to be used with [Theme.ClassAttributeCallback].
+func (t *Theme) CSS(recognisedNames []string, prefix string) string {
+	var css strings.Builder
+	for i, style := range t.resolve(recognisedNames) {
+		if style == nil {
+			continue
+		}
+		declarations := CSSDeclarations(*style)
+		if declarations == "" {
+			continue
+		}
+		fmt.Fprintf(&css, ".%s { %s }\n", ClassName(recognisedNames[i], prefix), declarations)
+	}
+	return css.String()
+}
+
+// ClassName returns the CSS class name for a capture name, e.g. `ts-function-method`
+// for `function.method` with the prefix `ts-`.
+func ClassName(captureName string, prefix string) string {
+	return prefix + strings.ReplaceAll(captureName, ".", "-")
+}
+
+// CSSDeclarations returns the CSS declarations for a style, e.g.
+// `color: #ff0000; font-weight: bold;`.
+func CSSDeclarations(style types.Style) string {
+	var declarations []string
+	if style.Foreground != nil {
+		declarations = append(declarations, "color: "+Hex(*style.Foreground)+";")
+	}
+	if style.Background != nil {
+		declarations = append(declarations, "background-color: "+Hex(*style.Background)+";")
+	}
+	if style.Bold {
+		declarations = append(declarations, "font-weight: bold;")
+	}
+	if style.Italic {
+		declarations = append(declarations, "font-style: italic;")
+	}
+
+	var decorations []string
+	if style.Underline {
+		decorations = append(decorations, "underline")
+	}
+	if style.Strikethrough {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		declarations = append(declarations, "text-decoration: "+strings.Join(decorations, " ")+";")
+	}
+
+	return strings.Join(declarations, " ")
+}
+
+// Hex returns a color in `#rrggbb` notation.
+func Hex(c types.Color) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,394 @@
+package theme
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by theme files: tables, dotted
+// and quoted keys, single-line basic and literal strings, booleans, numbers,
+// arrays and single-line inline tables. Multi-line strings, arrays of tables
+// and dates and times aren't supported, and are errors.
+func parseTOML(data string) (map[string]any, error) {
+	p := &tomlParser{data: data, line: 1}
+	root := map[string]any{}
+	current := root
+
+	for {
+		p.skipBlank()
+		if p.done() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			p.pos++
+			if !p.done() && p.peek() == '[' {
+				return nil, p.errorf("arrays of tables are not supported")
+			}
+			keys, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if err := p.expect(']'); err != nil {
+				return nil, err
+			}
+			current, err = p.table(root, keys)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := p.parseKeyValue(current); err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) done() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.data[p.pos]
+}
+
+func (p *tomlParser) expect(c byte) error {
+	if p.done() || p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments.
+func (p *tomlParser) skipBlank() {
+	for !p.done() {
+		switch p.peek() {
+		case ' ', '\t', '\r':
+			p.pos++
+		case '\n':
+			p.line++
+			p.pos++
+		case '#':
+			for !p.done() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if !p.done() && p.peek() == '#' {
+		for !p.done() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+	if !p.done() && p.peek() == '\r' {
+		p.pos++
+	}
+	if p.done() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q", p.peek())
+	}
+	return nil
+}
+
+// table returns the table at the given keys, creating it if needed.
+func (p *tomlParser) table(root map[string]any, keys []string) (map[string]any, error) {
+	current := root
+	for _, key := range keys {
+		next, ok := current[key]
+		if !ok {
+			table := map[string]any{}
+			current[key] = table
+			current = table
+			continue
+		}
+		table, ok := next.(map[string]any)
+		if !ok {
+			return nil, p.errorf("%s is not a table", key)
+		}
+		current = table
+	}
+	return current, nil
+}
+
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.done() {
+			return nil, p.errorf("expected key")
+		}
+
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.done() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected key")
+			}
+			key = p.data[start:p.pos]
+		}
+		keys = append(keys, key)
+
+		p.skipSpace()
+		if p.done() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]any) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	p.skipSpace()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	table, err = p.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	if _, ok := table[key]; ok {
+		return p.errorf("duplicate key %s", key)
+	}
+	table[key] = value
+	return nil
+}
+
+func (p *tomlParser) parseValue() (any, error) {
+	if p.done() {
+		return nil, p.errorf("expected value")
+	}
+
+	switch c := p.peek(); {
+	case strings.HasPrefix(p.data[p.pos:], `"""`) || strings.HasPrefix(p.data[p.pos:], "'''"):
+		return nil, p.errorf("multi-line strings are not supported")
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	default:
+		start := p.pos
+		for !p.done() && !isValueEnd(p.peek()) {
+			p.pos++
+		}
+		switch p.data[start:p.pos] {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		s := strings.ReplaceAll(p.data[start:p.pos], "_", "")
+		if s == "" {
+			return nil, p.errorf("expected value")
+		}
+		if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+		if isDateTime(s) {
+			return nil, p.errorf("dates and times are not supported")
+		}
+		return nil, p.errorf("invalid value %q", p.data[start:p.pos])
+	}
+}
+
+// isDateTime reports whether s starts like a TOML date, `1979-05-27`, or
+// time, `07:32:00`.
+func isDateTime(s string) bool {
+	isDigits := func(s string) bool {
+		return s != "" && strings.Trim(s, "0123456789") == ""
+	}
+	return len(s) >= 10 && isDigits(s[:4]) && s[4] == '-' && isDigits(s[5:7]) && s[7] == '-' && isDigits(s[8:10]) ||
+		len(s) >= 8 && isDigits(s[:2]) && s[2] == ':' && isDigits(s[3:5]) && s[5] == ':' && isDigits(s[6:8])
+}
+
+// isValueEnd reports whether c ends a bare value, like a number or boolean.
+func isValueEnd(c byte) bool {
+	return strings.IndexByte(" \t\r\n#,]}", c) != -1
+}
+
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+
+	var result strings.Builder
+	for {
+		if p.done() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == quote:
+			return result.String(), nil
+		case c == '\\' && quote == '"':
+			if p.done() {
+				return "", p.errorf("unterminated string")
+			}
+			escape := p.peek()
+			p.pos++
+			switch escape {
+			case 'n':
+				result.WriteByte('\n')
+			case 't':
+				result.WriteByte('\t')
+			case 'r':
+				result.WriteByte('\r')
+			case '"', '\\':
+				result.WriteByte(escape)
+			case 'u', 'U':
+				size := 4
+				if escape == 'U' {
+					size = 8
+				}
+				if p.pos+size > len(p.data) {
+					return "", p.errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.data[p.pos:p.pos+size], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				result.WriteRune(rune(r))
+				p.pos += size
+			default:
+				return "", p.errorf("invalid escape \\%c", escape)
+			}
+		default:
+			result.WriteByte(c)
+		}
+	}
+}
+
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.pos++
+
+	var result []any
+	for {
+		p.skipBlank()
+		if p.done() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return result, nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+
+		p.skipBlank()
+		if p.done() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+	p.pos++
+
+	result := map[string]any{}
+	for {
+		p.skipSpace()
+		if p.done() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		if p.peek() == '\n' || p.peek() == '\r' {
+			return nil, p.errorf("inline tables must be on a single line")
+		}
+		if p.peek() == '}' {
+			p.pos++
+			return result, nil
+		}
+
+		if err := p.parseKeyValue(result); err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.done() {
+			return nil, p.errorf("unterminated inline table")
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		case '\r', '\n':
+			return nil, p.errorf("inline tables must be on a single line")
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package theme
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]any
+	}{
+		{
+			name: "values",
+			data: "a = \"x\"\nb = 'y'\nc = true\nd = false\ne = 1_000\nf = 0x1f\ng = 1.5\nh = -2 # comment\n",
+			want: map[string]any{"a": "x", "b": "y", "c": true, "d": false, "e": int64(1000), "f": int64(31), "g": 1.5, "h": int64(-2)},
+		},
+		{
+			name: "tables and dotted keys",
+			data: "[ui]\nbackground = { fg = \"#ffffff\", modifiers = [\"bold\"] }\n\n[palette]\n\"my color\".x = 1\n",
+			want: map[string]any{
+				"ui":      map[string]any{"background": map[string]any{"fg": "#ffffff", "modifiers": []any{"bold"}}},
+				"palette": map[string]any{"my color": map[string]any{"x": int64(1)}},
+			},
+		},
+		{
+			name: "arrays",
+			data: "a = [1, 2,]\nb = [\n  \"x\", # comment\n  \"y\"\n]\nc = []\nd = [true,false]\n",
+			want: map[string]any{"a": []any{int64(1), int64(2)}, "b": []any{"x", "y"}, "c": []any(nil), "d": []any{true, false}},
+		},
+		{
+			name: "escapes",
+			data: `a = "\"\\\té"` + "\r\n",
+			want: map[string]any{"a": "\"\\\té"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "array without commas", data: "a = [1 2]"},
+		{name: "unterminated array", data: "a = [1, 2"},
+		{name: "inline table without commas", data: "a = { b = 1 c = 2 }"},
+		{name: "unterminated inline table", data: "a = { b = 1"},
+		{name: "boolean prefix", data: "a = trueish"},
+		{name: "boolean suffix", data: "a = falsey"},
+		{name: "invalid number", data: "a = 12abc"},
+		{name: "missing value", data: "a = "},
+		{name: "missing equals", data: "a 1"},
+		{name: "text after value", data: "a = \"x\" y"},
+		{name: "duplicate key", data: "a = 1\na = 2"},
+		{name: "value is not a table", data: "a = 1\n[a]"},
+		{name: "unterminated string", data: "a = \"x\nb = 1"},
+		{name: "invalid escape", data: `a = "\q"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := parseTOML(tt.data); err == nil {
+				t.Errorf("got %#v, want error", got)
+			}
+		})
+	}
+}
+
+func TestParseTOMLUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "multi-line basic string", data: "a = \"\"\"\nx\n\"\"\"", want: "line 1: multi-line strings are not supported"},
+		{name: "multi-line literal string", data: "a = 1\nb = '''x'''", want: "line 2: multi-line strings are not supported"},
+		{name: "array of tables", data: "[[a]]\nb = 1", want: "line 1: arrays of tables are not supported"},
+		{name: "multi-line inline table", data: "a = {\n  b = 1\n}", want: "line 1: inline tables must be on a single line"},
+		{name: "inline table ending on another line", data: "a = { b = 1\n}", want: "line 1: inline tables must be on a single line"},
+		{name: "date", data: "a = 1979-05-27", want: "line 1: dates and times are not supported"},
+		{name: "date and time", data: "a = 1979-05-27T07:32:00Z", want: "line 1: dates and times are not supported"},
+		{name: "time", data: "a = 07:32:00", want: "line 1: dates and times are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.data)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got %#v, %v, want error %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package types
+
+import (
+	"slices"
+	"strings"
+
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// CaptureResolution is the recognised name a capture name of the highlights
+// query resolves to.
+type CaptureResolution struct {
+	// Name is the capture name, like `function.method.builtin`.
+	Name string
+	// Highlight is the index of the recognised name, or nil if the capture
+	// matches no recognised name and is dropped.
+	Highlight *CaptureIndex
+	// RecognisedName is the recognised name the capture resolves to, like
+	// `function.method` or `function` if `function.method.builtin` isn't
+	// recognised, or "" if the capture is dropped.
+	RecognisedName string
+}
+
+// Fallback reports whether the capture resolves to a shorter recognised name
+// than its own.
+func (r CaptureResolution) Fallback() bool {
+	return r.Highlight != nil && r.RecognisedName != r.Name
+}
+
+// Dropped reports whether the capture matches no recognised name, so it is
+// never highlighted.
+func (r CaptureResolution) Dropped() bool {
+	return r.Highlight == nil
+}
+
+// CaptureNames returns the capture names used by the highlights query, in
+// the order they first appear. Captures starting with `_`, which are only
+// used by predicates, are left out.
+func (c *Configuration) CaptureNames() []string {
+	if c.Query == nil {
+		return nil
+	}
+
+	captureNames := c.Query.CaptureNames()
+	used := make([]bool, len(captureNames))
+	for i := c.HighlightsPatternIndex; i < c.Query.PatternCount(); i++ {
+		for j, quantifier := range c.Query.CaptureQuantifiers(i) {
+			if quantifier != tree_sitter.CaptureQuantifierZero {
+				used[j] = true
+			}
+		}
+	}
+
+	var names []string
+	for i, name := range captureNames {
+		if used[i] && !strings.HasPrefix(name, "_") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Captures returns how each of the [Configuration.CaptureNames] resolves to
+// a recognised name.
+func (c *Configuration) Captures() []CaptureResolution {
+	var resolutions []CaptureResolution
+	for _, name := range c.CaptureNames() {
+		resolution := CaptureResolution{Name: name}
+		if i, ok := c.Query.CaptureIndexForName(name); ok && int(i) < len(c.HighlightIndices) {
+			resolution.Highlight = c.HighlightIndices[i]
+		}
+		if resolution.Highlight != nil && int(*resolution.Highlight) < len(c.RecognisedNames) {
+			resolution.RecognisedName = c.RecognisedNames[*resolution.Highlight]
+		}
+		resolutions = append(resolutions, resolution)
+	}
+	return resolutions
+}
+
+// FallbackCaptures returns the captures that resolve to a shorter recognised
+// name than their own, like `function.method.builtin` to `function`.
+func (c *Configuration) FallbackCaptures() []CaptureResolution {
+	return slices.DeleteFunc(c.Captures(), func(r CaptureResolution) bool {
+		return !r.Fallback()
+	})
+}
+
+// DroppedCaptures returns the capture names that match no recognised name,
+// so they are never highlighted.
+func (c *Configuration) DroppedCaptures() []string {
+	var names []string
+	for _, resolution := range c.Captures() {
+		if resolution.Dropped() {
+			names = append(names, resolution.Name)
+		}
+	}
+	return names
+}
+
+// UnusedNames returns the recognised names that no capture of the highlights
+// query resolves to, so they never appear in the output of this language.
+// Injected languages have configurations of their own.
+func (c *Configuration) UnusedNames() []string {
+	used := make([]bool, len(c.RecognisedNames))
+	for _, resolution := range c.Captures() {
+		if resolution.Highlight != nil && int(*resolution.Highlight) < len(used) {
+			used[*resolution.Highlight] = true
+		}
+	}
+
+	var names []string
+	for i, name := range c.RecognisedNames {
+		if !used[i] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,149 @@
+package types_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/config"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/testlang"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+)
+
+// resolution is a [types.CaptureResolution] without the index, which is the
+// index of the recognised name.
+type resolution struct {
+	name           string
+	recognisedName string
+}
+
+func TestConfigurationCaptures(t *testing.T) {
+	tests := []struct {
+		name            string
+		highlights      string
+		locals          string
+		recognisedNames []string
+		want            []resolution
+		wantFallbacks   []string
+		wantDropped     []string
+		wantUnused      []string
+	}{
+		{
+			name:            "exact names",
+			highlights:      "(identifier) @variable\n(integer) @number\n",
+			recognisedNames: []string{"number", "variable"},
+			want:            []resolution{{"variable", "variable"}, {"number", "number"}},
+		},
+		{
+			name:            "fallback to the longest recognised prefix",
+			highlights:      "(identifier) @function.method.builtin\n(integer) @constant.numeric.integer\n(string) @string.special\n",
+			recognisedNames: []string{"function", "function.method", "constant.numeric", "string"},
+			want: []resolution{
+				{"function.method.builtin", "function.method"},
+				{"constant.numeric.integer", "constant.numeric"},
+				{"string.special", "string"},
+			},
+			wantFallbacks: []string{"function.method.builtin", "constant.numeric.integer", "string.special"},
+			wantUnused:    []string{"function"},
+		},
+		{
+			// Names only fall back to shorter names at dots, so `variable.member`
+			// matches neither `var` nor `variable.member.private`.
+			name:            "dropped names",
+			highlights:      "(identifier) @variable.member\n(integer) @number\n(comment) @comment\n",
+			recognisedNames: []string{"var", "variable.member.private", "comment"},
+			want:            []resolution{{"variable.member", ""}, {"number", ""}, {"comment", "comment"}},
+			wantDropped:     []string{"variable.member", "number"},
+			wantUnused:      []string{"var", "variable.member.private"},
+		},
+		{
+			name:            "captures only used by predicates",
+			highlights:      "((identifier) @_name @variable (#eq? @_name \"self\"))\n",
+			recognisedNames: []string{"variable"},
+			want:            []resolution{{"variable", "variable"}},
+		},
+		{
+			name:            "locals captures",
+			highlights:      "(identifier) @variable\n",
+			locals:          "(function_definition) @local.scope\n(parameters (identifier) @local.definition)\n(identifier) @local.reference\n",
+			recognisedNames: []string{"variable", "local"},
+			want:            []resolution{{"variable", "variable"}},
+			wantUnused:      []string{"local"},
+		},
+		{
+			name:            "no recognised names",
+			highlights:      "(identifier) @variable\n",
+			recognisedNames: nil,
+			want:            []resolution{{"variable", ""}},
+			wantDropped:     []string{"variable"},
+		},
+	}
+
+	lang := testlang.Language("python")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.New(lang.Lang, lang.Name, []byte(tt.highlights), nil, []byte(tt.locals), tt.recognisedNames)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []resolution
+			for _, r := range cfg.Captures() {
+				got = append(got, resolution{r.Name, r.RecognisedName})
+				if r.Dropped() {
+					continue
+				}
+				if name := tt.recognisedNames[*r.Highlight]; name != r.RecognisedName {
+					t.Errorf("%s resolves to index %d, which is %s and not %s", r.Name, *r.Highlight, name, r.RecognisedName)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got captures %v, want %v", got, tt.want)
+			}
+
+			var fallbacks []string
+			for _, r := range cfg.FallbackCaptures() {
+				fallbacks = append(fallbacks, r.Name)
+			}
+			if !slices.Equal(fallbacks, tt.wantFallbacks) {
+				t.Errorf("got fallback captures %q, want %q", fallbacks, tt.wantFallbacks)
+			}
+			if got := cfg.DroppedCaptures(); !slices.Equal(got, tt.wantDropped) {
+				t.Errorf("got dropped captures %q, want %q", got, tt.wantDropped)
+			}
+			if got := cfg.UnusedNames(); !slices.Equal(got, tt.wantUnused) {
+				t.Errorf("got unused names %q, want %q", got, tt.wantUnused)
+			}
+		})
+	}
+}
+
+func TestConfigurationCapturesWithoutQuery(t *testing.T) {
+	cfg := types.Configuration{RecognisedNames: []string{"variable"}}
+	if got := cfg.Captures(); got != nil {
+		t.Errorf("got captures %v, want none", got)
+	}
+	if got := cfg.UnusedNames(); !slices.Equal(got, []string{"variable"}) {
+		t.Errorf("got unused names %q, want %q", got, []string{"variable"})
+	}
+}
+
+func TestCaptureResolution(t *testing.T) {
+	index := types.CaptureIndex(0)
+	tests := []struct {
+		resolution   types.CaptureResolution
+		wantFallback bool
+		wantDropped  bool
+	}{
+		{resolution: types.CaptureResolution{Name: "function", Highlight: &index, RecognisedName: "function"}},
+		{resolution: types.CaptureResolution{Name: "function.builtin", Highlight: &index, RecognisedName: "function"}, wantFallback: true},
+		{resolution: types.CaptureResolution{Name: "function"}, wantDropped: true},
+	}
+	for _, tt := range tests {
+		if got := tt.resolution.Fallback(); got != tt.wantFallback {
+			t.Errorf("%+v: Fallback() = %t, want %t", tt.resolution, got, tt.wantFallback)
+		}
+		if got := tt.resolution.Dropped(); got != tt.wantDropped {
+			t.Errorf("%+v: Dropped() = %t, want %t", tt.resolution, got, tt.wantDropped)
+		}
+	}
+}
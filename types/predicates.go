@@ -0,0 +1,129 @@
+package types
+
+import tree_sitter "github.com/tree-sitter/go-tree-sitter"
+
+// PredicateCall is a call of a custom predicate or directive in a pattern
+// of a query, like `(#lua-match? @name "^%u")`.
+type PredicateCall struct {
+	// Operator is the name of the predicate or directive, like `lua-match?`.
+	Operator string
+	// Args are the captures and strings the predicate is called with.
+	Args []tree_sitter.QueryPredicateArg
+	// Match is the match of the pattern.
+	Match *tree_sitter.QueryMatch
+	// Source is the source code of the document.
+	Source []byte
+}
+
+// Capture returns the index of the capture of the argument i, if it is a
+// capture.
+func (c PredicateCall) Capture(i int) (uint, bool) {
+	if i >= len(c.Args) || c.Args[i].CaptureId == nil {
+		return 0, false
+	}
+	return *c.Args[i].CaptureId, true
+}
+
+// Nodes returns the nodes captured by the capture of the argument i, or nil
+// if it isn't a capture.
+func (c PredicateCall) Nodes(i int) []tree_sitter.Node {
+	capture, ok := c.Capture(i)
+	if !ok {
+		return nil
+	}
+	return c.Match.NodesForCaptureIndex(capture)
+}
+
+// String returns the argument i, if it is a string.
+func (c PredicateCall) String(i int) (string, bool) {
+	if i >= len(c.Args) || c.Args[i].String == nil {
+		return "", false
+	}
+	return *c.Args[i].String, true
+}
+
+// Strings returns the string arguments from i on.
+func (c PredicateCall) Strings(i int) []string {
+	var values []string
+	for ; i < len(c.Args); i++ {
+		if value, ok := c.String(i); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Text returns the source code of a node.
+func (c PredicateCall) Text(node tree_sitter.Node) string {
+	return node.Utf8Text(c.Source)
+}
+
+// MatchMetadata is what directives found out about a match of an injection
+// pattern.
+type MatchMetadata struct {
+	// Properties are set like `#set!` properties. An `injection.language`
+	// property names the language of an injection, unless it is captured.
+	Properties map[string]string
+	// Ranges replace the ranges of captures, by capture index. The range of
+	// an `@injection.content` capture narrows the injected content.
+	Ranges map[uint]tree_sitter.Range
+	// Texts replace the source code of captures, by capture index, like the
+	// text of an `@injection.language` capture.
+	Texts map[uint]string
+}
+
+// Set sets a property.
+func (m *MatchMetadata) Set(key string, value string) {
+	if m.Properties == nil {
+		m.Properties = make(map[string]string)
+	}
+	m.Properties[key] = value
+}
+
+// SetRange replaces the range of a capture.
+func (m *MatchMetadata) SetRange(capture uint, r tree_sitter.Range) {
+	if m.Ranges == nil {
+		m.Ranges = make(map[uint]tree_sitter.Range)
+	}
+	m.Ranges[capture] = r
+}
+
+// SetText replaces the source code of a capture.
+func (m *MatchMetadata) SetText(capture uint, text string) {
+	if m.Texts == nil {
+		m.Texts = make(map[uint]string)
+	}
+	m.Texts[capture] = text
+}
+
+// This runs for a custom predicate like `#lua-match?` in a query, and
+// returns whether the match satisfies it. Matches that don't are skipped.
+// For a predicate that isn't registered, a registered predicate without the
+// `not-` prefix is negated, so that `#not-has-parent?` works if
+// `has-parent?` is registered. Predicates that aren't registered are
+// ignored.
+type Predicate func(call PredicateCall) bool
+
+// This runs for a custom directive like `#offset!` in an injection pattern,
+// and can change the metadata of the match. Directives run in the order of
+// the pattern, so later ones see the changes of earlier ones. Directives
+// that aren't registered are ignored.
+type Directive func(call PredicateCall, metadata *MatchMetadata)
+
+// RegisterPredicate registers a custom predicate, by its name with the
+// trailing `?`, like `lua-match?`.
+func (c *Configuration) RegisterPredicate(name string, predicate Predicate) {
+	if c.Predicates == nil {
+		c.Predicates = make(map[string]Predicate)
+	}
+	c.Predicates[name] = predicate
+}
+
+// RegisterDirective registers a custom directive, by its name with the
+// trailing `!`, like `offset!`.
+func (c *Configuration) RegisterDirective(name string, directive Directive) {
+	if c.Directives == nil {
+		c.Directives = make(map[string]Directive)
+	}
+	c.Directives[name] = directive
+}
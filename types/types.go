@@ -13,6 +13,7 @@ type Configuration struct {
 	LocalsPatternIndex            uint
 	HighlightsPatternIndex        uint
 	HighlightIndices              []*CaptureIndex
+	RecognisedNames               []string
 	NonLocalVariablePatterns      []bool
 	InjectionContentCaptureIndex  *uint
 	InjectionLanguageCaptureIndex *uint
@@ -20,6 +21,9 @@ type Configuration struct {
 	LocalDefCaptureIndex          *uint
 	LocalDefValueCaptureIndex     *uint
 	LocalRefCaptureIndex          *uint
+	Predicates                    map[string]Predicate
+	Directives                    map[string]Directive
+	InjectionDetector             InjectionDetector
 }
 
 // This function runs when tree-sitter encounters an injection. This is when
@@ -30,9 +34,108 @@ type Configuration struct {
 // function for the new language.
 type InjectionCallback func(languageName string) *Configuration
 
+// This runs for an injection whose language isn't captured or set, like a
+// Markdown code block without an info string, if it is set on the
+// configuration of the outer language. It gets the source code of the
+// injection, and returns the name of its language, for example from a `#!`
+// line, or "" if it can't tell. The name is passed to the
+// [InjectionCallback].
+type InjectionDetector func(content []byte) string
+
 // This runs for every single output `<span>` element, and is used to add
 // attributes to the element. You can use this to add class names, inline
 // styles based on a theme, or whatever else you'd like. For example, if you
 // return `class="ts-highlight"` from inside the function, every `<span>`
 // element in your output will look like `<span class="ts-highlight">`.
 type AttributeCallback func(h CaptureIndex, languageName string) string
+
+// Capture describes a highlighted node, for a [NodeAttributeCallback].
+type Capture struct {
+	// Highlight is the index of the recognised name of the highlight.
+	Highlight CaptureIndex
+	// Name is the full name of the capture in the highlights query, like
+	// `function.method.builtin`.
+	Name string
+	// LanguageName is the name of the language of the layer.
+	LanguageName string
+	// Depth is the depth of the layer, 0 for the root language and 1 or more
+	// for injections.
+	Depth uint
+	// Kind is the kind of the captured node, like `identifier`.
+	Kind string
+	// Range is the range of the captured node in the source.
+	Range tree_sitter.Range
+	// Text is the source code of the captured node.
+	Text string
+}
+
+// NodeAttributes are the attributes of the output element of a highlight.
+type NodeAttributes struct {
+	// Attributes are added to the element as they are, like the result of an
+	// [AttributeCallback].
+	Attributes string
+	// Title is added as the `title` attribute, shown as a tooltip, if it
+	// isn't empty. It is escaped.
+	Title string
+	// Href makes the element a link `<a href="...">` instead of a `<span>`, if
+	// it isn't empty. It is escaped.
+	Href string
+}
+
+// This runs for every output element like an [AttributeCallback], but gets
+// the captured node, so it can add tooltips, `data-` attributes or links
+// for identifiers.
+type NodeAttributeCallback func(capture Capture) NodeAttributes
+
+// LineEndings is how renderers write carriage returns. It doesn't change
+// the byte offsets in highlight events, which always refer to the source.
+type LineEndings int
+
+const (
+	// LineEndingsNormalize writes `\r\n` and lone `\r` as `\n`.
+	LineEndingsNormalize LineEndings = iota
+	// LineEndingsPreserve writes carriage returns as they are, so the text of
+	// the output matches the source byte for byte.
+	LineEndingsPreserve
+	// LineEndingsVisible writes carriage returns as `␍`, followed by the line
+	// break if there is one.
+	LineEndingsVisible
+)
+
+// Whitespace configures how renderers write tabs and spaces.
+type Whitespace struct {
+	// TabWidth is the number of columns between tab stops. Tabs are expanded
+	// to spaces if it isn't 0. Columns are counted in characters, not bytes.
+	TabWidth int
+	// Tabs marks all tabs.
+	Tabs bool
+	// Spaces marks all spaces.
+	Spaces bool
+	// Trailing marks the tabs and spaces at the end of lines.
+	Trailing bool
+	// Glyphs shows marked tabs as `→` and marked spaces as `·`. Terminal
+	// output always uses glyphs, as it can't mark whitespace otherwise.
+	Glyphs bool
+}
+
+// Color is a 24-bit RGB color.
+type Color struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+// Style describes how a highlight is displayed. Colors that are nil are
+// inherited from the enclosing highlight, or the default of the output.
+type Style struct {
+	Foreground    *Color
+	Background    *Color
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strikethrough bool
+}
+
+// This runs for every highlight in the terminal output, and returns the
+// style the highlighted text is printed with.
+type StyleCallback func(h CaptureIndex, languageName string) Style
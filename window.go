@@ -0,0 +1,99 @@
+package highlight
+
+import (
+	"context"
+	"iter"
+	"strings"
+
+	"github.com/noclaps/go-tree-sitter-highlight/internal/highlight"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/html"
+	"github.com/noclaps/go-tree-sitter-highlight/internal/lines"
+	"github.com/noclaps/go-tree-sitter-highlight/types"
+	tree_sitter "github.com/tree-sitter/go-tree-sitter"
+)
+
+// Window is the part of the source, in bytes, that is highlighted by
+// [HighlightEventsWindow]. A window that goes past the end of the source
+// ends with it.
+type Window = highlight.Window
+
+// LineWindow returns the window of the given 1-based lines, including the
+// line break of the last line. Lines end like in [SplitLines], so that a
+// lone `\r` starts a new line.
+func LineWindow(source string, lineRange LineRange) Window {
+	return Window{
+		StartByte: lines.Offset(source, lineRange.Start-1, LineEndingsNormalize),
+		EndByte:   lines.Offset(source, lineRange.End, LineEndingsNormalize),
+	}
+}
+
+// PointWindow returns the window between the given points, with 0-based rows
+// and byte columns like in tree-sitter. Columns past the end of their line
+// are clamped to it.
+func PointWindow(source string, start tree_sitter.Point, end tree_sitter.Point) Window {
+	return Window{
+		StartByte: pointOffset(source, start),
+		EndByte:   pointOffset(source, end),
+	}
+}
+
+// lineOffset returns the byte offset of the start of the 0-based row, or the
+// length of the source if it has fewer rows. Rows only end at `\n`, like in
+// tree-sitter.
+func lineOffset(source string, line int) uint {
+	var offset int
+	for range max(line, 0) {
+		i := strings.IndexByte(source[offset:], '\n')
+		if i == -1 {
+			return uint(len(source))
+		}
+		offset += i + 1
+	}
+	return uint(offset)
+}
+
+func pointOffset(source string, point tree_sitter.Point) uint {
+	offset := lineOffset(source, int(point.Row))
+	lineEnd := uint(len(source))
+	if i := strings.IndexByte(source[offset:], '\n'); i != -1 {
+		lineEnd = offset + uint(i)
+	}
+	return min(offset+point.Column, lineEnd)
+}
+
+// HighlightEventsWindow returns the highlight events of only the window of
+// the source code. The whole source is still parsed, so the highlights are
+// the same as in the output of [HighlightEvents], but only the captures in the
+// window are queried. The events start with the layers and highlights that
+// are open at the start of the window, and end with their end events.
+//
+// Because captures before the window are skipped, local variables that are
+// defined before the window are highlighted like any other variable.
+func HighlightEventsWindow(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, window Window) iter.Seq2[Event, error] {
+	return defaultHighlighter.HighlightEventsWindow(ctx, cfg, source, injectionCallback, window)
+}
+
+// HighlightEventsWindow returns the highlight events of only the window of
+// the source code. See [HighlightEventsWindow].
+func (h *Highlighter) HighlightEventsWindow(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, window Window) iter.Seq2[Event, error] {
+	return h.highlightEvents(ctx, cfg, source, injectionCallback, nil, &window)
+}
+
+// HighlightWindow highlights only the window of the source code and returns
+// it as HTML. See [HighlightEventsWindow].
+func HighlightWindow(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback, window Window) (string, error) {
+	return defaultHighlighter.HighlightWindow(ctx, cfg, source, injectionCallback, attributeCallback, window)
+}
+
+// HighlightWindow highlights only the window of the source code and returns
+// it as HTML. See [HighlightEventsWindow].
+func (h *Highlighter) HighlightWindow(ctx context.Context, cfg types.Configuration, source string, injectionCallback types.InjectionCallback, attributeCallback types.AttributeCallback, window Window) (string, error) {
+	events := h.HighlightEventsWindow(ctx, cfg, source, injectionCallback, window)
+	return html.Render(events, source, attributeCallback)
+}
+
+// HighlightEventsWindow returns the highlight events of only the window of
+// the document, without parsing it again. See [HighlightEventsWindow].
+func (d *Document) HighlightEventsWindow(ctx context.Context, window Window) iter.Seq2[Event, error] {
+	return d.highlighter.highlightEvents(ctx, d.cfg, d.source, d.injectionCallback, documentTrees(d.layers), &window)
+}